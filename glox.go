@@ -2,9 +2,14 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"lox/glox"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 )
 
@@ -14,43 +19,174 @@ func checkErr(err error) {
 	}
 }
 
-func runScript(scriptName string) {
+func runScript(scriptName string, opts ...glox.RuntimeOption) {
 	dat, err := os.ReadFile(scriptName)
 	checkErr(err)
 
-	runtime := glox.NewRuntime()
-	runtime.Run(string(dat), 0)
+	runtime := glox.NewRuntime(append(opts, glox.WithFileName(scriptName))...)
+	if err := runtime.Run(string(dat), 0); err != nil {
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode is the status to exit with once err has been reported: 65 when
+// the script's source is at fault and 70 when it went wrong while running.
+func exitCode(err error) int {
+	var list glox.ErrorList
+	if errors.As(err, &list) {
+		return 65
+	}
+	return 70
+}
+
+// runCached runs a script from the .loxc file next to it, compiling the
+// script and saving it there first if the file is missing or out of date.
+func runCached(scriptName string, opts ...glox.RuntimeOption) {
+	dat, err := os.ReadFile(scriptName)
+	checkErr(err)
+
+	runtime := glox.NewRuntime(append(opts, glox.WithFileName(scriptName), glox.WithEngine(glox.EngineVM))...)
+	cacheName := strings.TrimSuffix(scriptName, filepath.Ext(scriptName)) + ".loxc"
 
-	if runtime.HadError {
-		os.Exit(65)
+	program, err := loadProgram(cacheName, string(dat))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "glox: recompiling %s: %v\n", cacheName, err)
+	}
+	if program == nil {
+		if program, err = runtime.Compile(string(dat)); err != nil {
+			os.Exit(exitCode(err))
+		}
+		if err := saveProgram(cacheName, program); err != nil {
+			fmt.Fprintf(os.Stderr, "glox: can't save %s: %v\n", cacheName, err)
+		}
+	}
+
+	if err := runtime.RunProgram(context.Background(), program); err != nil {
+		os.Exit(exitCode(err))
+	}
+}
+
+func loadProgram(name string, source string) (*glox.Program, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return glox.ReadProgram(f, source)
+}
+
+func saveProgram(name string, program *glox.Program) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := program.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
 	}
+	return f.Close()
 }
 
-func runPrompt() {
+// dumpScript prints the bytecode a script compiles to instead of running it.
+func dumpScript(scriptName string, opts ...glox.RuntimeOption) {
+	dat, err := os.ReadFile(scriptName)
+	checkErr(err)
+
+	runtime := glox.NewRuntime(append(opts, glox.WithFileName(scriptName))...)
+	if err := runtime.DumpIR(os.Stdout, string(dat)); err != nil {
+		os.Exit(exitCode(err))
+	}
+}
+
+func runPrompt(opts ...glox.RuntimeOption) {
 	reader := bufio.NewReader(os.Stdin)
 	line := 0
-	runtime := glox.NewRuntime()
+	runtime := glox.NewRuntime(opts...)
 
 	for {
 		fmt.Printf("(%03d) -> ", line)
 		text, _ := reader.ReadString('\n')
 		text = strings.Replace(text, "\n", "", -1)
-		runtime.Run(text, line)
-		if runtime.HadError {
-			runtime.HadError = false // reset error so we don't kill the user's session
+		if text == "exit" || text == "exit!" || text == "quit" {
+			os.Exit(0)
 		}
+		runLine(runtime, text, line)
 
 		line += 1
 	}
 }
 
+// runLine evaluates one line of the REPL. Ctrl-C while it's running stops
+// the evaluation rather than the whole session.
+func runLine(runtime *glox.Runtime, text string, line int) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Errors have already been reported, and shouldn't kill the user's session.
+	runtime.RunContext(ctx, text, line)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: glox [--diagnostics=text|json|plain] [--allow=capabilities] [--engine=tree|vm] [--trace-exec] [--stress-gc] [--gc-growth=factor] [--cache] [--dump-ir script | script]")
+	flag.PrintDefaults()
+}
+
 func main() {
-	args := os.Args[1:]
-	if len(args) > 1 {
-		fmt.Println("Usage: glox [script]")
+	flag.Usage = usage
+	diagnostics := flag.String("diagnostics", "text", "how to report errors on stderr: text, json, or plain as jlox does")
+	// Scripts may only read the clock unless they're trusted with more.
+	allow := flag.String("allow", "time", "comma-separated capabilities natives may use, out of fs-read, fs-write, env, time and net")
+	engineName := flag.String("engine", "tree", "how to run scripts: tree to walk the syntax tree or vm for bytecode")
+	dumpIR := flag.Bool("dump-ir", false, "print the IR the script lowers to instead of running it")
+	cache := flag.Bool("cache", false, "run the script from a .loxc file of its bytecode, saving one if needed; implies --engine=vm")
+	traceExec := flag.Bool("trace-exec", false, "print each instruction to stderr as it runs; implies --engine=vm")
+	stressGC := flag.Bool("stress-gc", false, "collect garbage at every loop iteration and call, to shake out collector bugs")
+	gcGrowth := flag.Float64("gc-growth", 2, "how many times bigger the heap may grow than what survived the last collection")
+	flag.Parse()
+
+	format, err := glox.ParseDiagnosticFormat(*diagnostics)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		usage()
+		os.Exit(64)
+	}
+	capabilities, err := glox.ParseCapabilities(*allow)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		usage()
+		os.Exit(64)
+	}
+	engine, err := glox.ParseEngine(*engineName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		usage()
+		os.Exit(64)
+	}
+	opts := []glox.RuntimeOption{
+		glox.WithDiagnostics(format),
+		glox.WithCapabilities(capabilities...),
+		glox.WithEngine(engine),
+		glox.WithHeapGrowth(*gcGrowth),
+	}
+	if *stressGC {
+		opts = append(opts, glox.WithStressGC())
+	}
+	if *traceExec {
+		opts = append(opts, glox.WithEngine(glox.EngineVM), glox.WithTraceExec(os.Stderr))
+	}
+
+	args := flag.Args()
+	if len(args) > 1 || (*dumpIR && len(args) == 0) {
+		usage()
+		os.Exit(64)
+	} else if *dumpIR {
+		dumpScript(args[0], opts...)
+	} else if len(args) == 1 && *cache {
+		runCached(args[0], opts...)
 	} else if len(args) == 1 {
-		runScript(args[0])
+		runScript(args[0], opts...)
 	} else {
-		runPrompt()
+		runPrompt(opts...)
 	}
 }
@@ -50,6 +50,38 @@ func (ap *astPrinter) visitUnaryExpr(expr *Unary) (interface{}, error) {
 	return ap.parenthesize(expr.Operator.lexeme, expr.Right)
 }
 
+func (ap *astPrinter) visitVariableExpr(expr *Variable) (interface{}, error) {
+	return expr.Name.lexeme, nil
+}
+
+func (ap *astPrinter) visitAssignExpr(expr *Assign) (interface{}, error) {
+	return ap.parenthesize("= "+expr.Name.lexeme, expr.Value)
+}
+
+func (ap *astPrinter) visitLogicalExpr(expr *Logical) (interface{}, error) {
+	return ap.parenthesize(expr.Operator.lexeme, expr.Left, expr.Right)
+}
+
+func (ap *astPrinter) visitCallExpr(expr *Call) (interface{}, error) {
+	return ap.parenthesize("call", append([]Expr{expr.Callee}, expr.Arguments...)...)
+}
+
+func (ap *astPrinter) visitGetExpr(expr *Get) (interface{}, error) {
+	return ap.parenthesize("."+expr.Name.lexeme, expr.Object)
+}
+
+func (ap *astPrinter) visitSetExpr(expr *Set) (interface{}, error) {
+	return ap.parenthesize("= ."+expr.Name.lexeme, expr.Object, expr.Value)
+}
+
+func (ap *astPrinter) visitThisExpr(expr *This) (interface{}, error) {
+	return "this", nil
+}
+
+func (ap *astPrinter) visitSuperExpr(expr *Super) (interface{}, error) {
+	return "super." + expr.Method.lexeme, nil
+}
+
 func (ap *astPrinter) parenthesize(name string, exprs ...Expr) (string, error) {
 	buf := bytes.Buffer{}
 	buf.WriteString("(" + name)
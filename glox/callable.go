@@ -0,0 +1,110 @@
+package glox
+
+import (
+	"fmt"
+	"time"
+)
+
+type LoxCallable interface {
+	arity() int
+	call(i *interpreter, arguments []Value) (Value, error)
+}
+
+type loxFunction struct {
+	gcHeader
+	declaration   *Function
+	closure       *environment
+	isInitializer bool
+}
+
+func NewLoxFunction(declaration *Function, closure *environment, isInitializer bool) *loxFunction {
+	return &loxFunction{
+		declaration:   declaration,
+		closure:       closure,
+		isInitializer: isInitializer,
+	}
+}
+
+// bind returns a copy of the method whose closure defines "this" as instance.
+func (f *loxFunction) bind(instance *loxInstance) *loxFunction {
+	env := NewEnvironment(f.closure)
+	env.define("this", instanceValue(instance))
+	return NewLoxFunction(f.declaration, env, f.isInitializer)
+}
+
+func (f *loxFunction) arity() int {
+	return len(f.declaration.Params)
+}
+
+func (f *loxFunction) call(i *interpreter, arguments []Value) (Value, error) {
+	env := NewEnvironment(f.closure)
+	i.gc.track(env)
+	for idx, param := range f.declaration.Params {
+		env.define(param.lexeme, arguments[idx])
+	}
+
+	err := i.executeBlock(f.declaration.Body, env)
+	if rv, ok := err.(*returnValue); ok {
+		if f.isInitializer {
+			return f.closure.getAt(0, "this"), nil
+		}
+		return rv.value, nil
+	}
+	if err != nil {
+		return Nil, err
+	}
+
+	if f.isInitializer {
+		return f.closure.getAt(0, "this"), nil
+	}
+	return Nil, nil
+}
+
+func (f *loxFunction) String() string {
+	return fmt.Sprintf("<fn %s>", f.declaration.Name.lexeme)
+}
+
+type nativeFunction struct {
+	name         string
+	arityValue   int
+	capabilities []Capability
+	fn           func(arguments []Value) (Value, error)
+}
+
+func (n *nativeFunction) arity() int {
+	return n.arityValue
+}
+
+func (n *nativeFunction) call(i *interpreter, arguments []Value) (Value, error) {
+	if err := i.checkCapabilities(n); err != nil {
+		return Nil, err
+	}
+	// The arguments are a slice of the interpreter's stack, which the next
+	// call overwrites; the native gets a copy it can keep.
+	return n.fn(append([]Value(nil), arguments...))
+}
+
+func (n *nativeFunction) String() string {
+	return "<native fn>"
+}
+
+func clockNative() *nativeFunction {
+	return &nativeFunction{
+		name:         "clock",
+		arityValue:   0,
+		capabilities: []Capability{CapTime},
+		fn: func(arguments []Value) (Value, error) {
+			return NumberValue(float64(time.Now().UnixNano()) / float64(time.Second)), nil
+		},
+	}
+}
+
+// returnValue unwinds the interpreter from a return statement back to the
+// enclosing call. It travels as an error so every visitor passes it along.
+type returnValue struct {
+	value Value
+}
+
+func (r *returnValue) Error() string {
+	return "return outside of function"
+}
@@ -0,0 +1,96 @@
+package glox
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFunctionReturnsValue(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	fun fib(n) {
+		if (n < 2) return n;
+		return fib(n - 1) + fib(n - 2);
+	}
+	var result = fib(10);
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	assertGlobal(interpreter, "result", NumberValue(55), t)
+}
+
+func TestFunctionWithoutReturnIsNil(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	fun noop() {}
+	var result = noop();
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	assertGlobal(interpreter, "result", Nil, t)
+}
+
+func TestClosuresCaptureDefiningEnvironment(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	fun makeCounter() {
+		var i = 0;
+		fun count() {
+			i = i + 1;
+			return i;
+		}
+		return count;
+	}
+	var counter = makeCounter();
+	counter();
+	var result = counter();
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	assertGlobal(interpreter, "result", NumberValue(2), t)
+}
+
+func TestCallArityMismatch(t *testing.T) {
+	_, err := interpretedSource(`
+	fun add(a, b) { return a + b; }
+	add(1);
+	`)
+
+	expected := "[Line 3] Error: Expected 2 arguments but got 1."
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected: %s Actual: %v", expected, err)
+	}
+}
+
+func TestCallNonCallable(t *testing.T) {
+	_, err := interpretedSource(`"not a function"();`)
+
+	expected := "[Line 1] Error: Can only call functions and classes."
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected: %s Actual: %v", expected, err)
+	}
+}
+
+func TestClockNative(t *testing.T) {
+	value, err := New(WithCapabilities(CapTime)).Eval(context.Background(), `clock();`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	if now, err := value.AsNumber(); err != nil || now <= 0 {
+		t.Errorf("Expected clock() to return a positive number, got %v", value)
+	}
+}
+
+func assertGlobal(interpreter *interpreter, name string, expected Value, t *testing.T) {
+	value, err := interpreter.globals.get(NewToken(IDENTIFIER, name, nil, 0))
+	if err != nil {
+		t.Fatalf("Expected global '%s' to be defined, got %v", name, err)
+	}
+	if !value.Equal(expected) {
+		t.Errorf("Global '%s' incorrect.\n\nExpected: %v\nGot: %v", name, expected, value)
+	}
+}
@@ -0,0 +1,65 @@
+package glox
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Capability is something a native function does beyond computing a result,
+// which a host has to allow before scripts may call it.
+type Capability string
+
+const (
+	CapFSRead  Capability = "fs-read"
+	CapFSWrite Capability = "fs-write"
+	CapEnv     Capability = "env"
+	CapTime    Capability = "time"
+	CapNet     Capability = "net"
+)
+
+// AllCapabilities is every capability, for running trusted scripts.
+var AllCapabilities = []Capability{CapFSRead, CapFSWrite, CapEnv, CapTime, CapNet}
+
+// ErrNotPermitted is the error a script stops with when it calls a native
+// that needs a capability the runtime hasn't been granted.
+var ErrNotPermitted = errors.New("not permitted")
+
+// ParseCapabilities reads a comma-separated list of capability names, as
+// given on the command line.
+func ParseCapabilities(names string) ([]Capability, error) {
+	var capabilities []Capability
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		capability := Capability(name)
+		if !capability.valid() {
+			return nil, fmt.Errorf("unknown capability '%s'", name)
+		}
+		capabilities = append(capabilities, capability)
+	}
+	return capabilities, nil
+}
+
+func (c Capability) valid() bool {
+	for _, capability := range AllCapabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCapabilities makes sure the native's capabilities have all been
+// granted before it's called.
+func (l *limits) checkCapabilities(native *nativeFunction) error {
+	for _, capability := range native.capabilities {
+		if !l.granted[capability] {
+			return fmt.Errorf("%w: %s needs the '%s' capability", ErrNotPermitted, native.name, capability)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package glox
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNativesNeedTheirCapabilities(t *testing.T) {
+	define := func(r *Runtime) {
+		r.DefineNative("readFile", 1, func(args []Value) (Value, error) {
+			return StringValue("contents"), nil
+		}, CapFSRead)
+		r.DefineFunc("getenv", func(name string) string { return "value" }, CapEnv)
+		r.DefineFunc("pure", func() bool { return true })
+	}
+
+	sandboxed := New()
+	define(sandboxed)
+	for _, source := range []string{`readFile("a");`, `getenv("HOME");`, "clock();"} {
+		_, err := sandboxed.Eval(context.Background(), source)
+		if !errors.Is(err, ErrNotPermitted) {
+			t.Errorf("%s: Expected ErrNotPermitted, got %v", source, err)
+		}
+	}
+	if _, err := sandboxed.Eval(context.Background(), "pure();"); err != nil {
+		t.Errorf("Expected natives without capabilities to be callable, got %v", err)
+	}
+
+	trusted := New(WithCapabilities(CapFSRead, CapEnv))
+	define(trusted)
+	for _, source := range []string{`readFile("a");`, `getenv("HOME");`} {
+		if _, err := trusted.Eval(context.Background(), source); err != nil {
+			t.Errorf("%s: Expected granted capabilities to allow the call, got %v", source, err)
+		}
+	}
+	if _, err := trusted.Eval(context.Background(), "clock();"); !errors.Is(err, ErrNotPermitted) {
+		t.Errorf("Expected only the granted capabilities to be allowed, got %v", err)
+	}
+}
+
+func TestNotPermittedMessage(t *testing.T) {
+	_, err := New().Eval(context.Background(), "clock();")
+
+	expected := "[Line 1] Error: not permitted: clock needs the 'time' capability"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected: %s Actual: %v", expected, err)
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	capabilities, err := ParseCapabilities("fs-read, time,,net")
+	if err != nil || len(capabilities) != 3 || capabilities[0] != CapFSRead || capabilities[2] != CapNet {
+		t.Errorf("Expected [fs-read time net], got %v, %v", capabilities, err)
+	}
+
+	if _, err := ParseCapabilities("fs-read,root"); err == nil {
+		t.Errorf("Expected unknown capabilities to be rejected")
+	}
+}
@@ -0,0 +1,158 @@
+package glox
+
+import "fmt"
+
+type opCode byte
+
+// Operands follow their opcode in the code, big end first. Constants take
+// two bytes, local and upvalue slots and argument counts one, and jumps four.
+// After opWide, the constants and slots of the next instruction take four
+// bytes too, so functions aren't limited in how many they use.
+const (
+	opConstant opCode = iota // constant
+	opNil
+	opTrue
+	opFalse
+	opPop
+	opGetLocal     // slot
+	opSetLocal     // slot
+	opGetGlobal    // name constant
+	opDefineGlobal // name constant
+	opSetGlobal    // name constant
+	opGetUpvalue   // slot
+	opSetUpvalue   // slot
+	opGetProperty  // name constant
+	opSetProperty  // name constant
+	opGetSuper     // name constant
+	opEqual
+	opGreater
+	opGreaterEqual
+	opLess
+	opLessEqual
+	opAdd
+	opSubtract
+	opMultiply
+	opDivide
+	opNot
+	opNegate
+	opPrint
+	opJump        // forward offset
+	opJumpIfFalse // forward offset
+	opLoop        // backward offset
+	opCall        // argument count
+	opClosure     // function constant, then a local flag and slot per upvalue
+	opCloseUpvalue
+	opReturn
+	opClass // name constant
+	opInherit
+	opMethod // name constant
+	opWide
+)
+
+var opNames = [...]string{
+	opConstant:     "CONSTANT",
+	opNil:          "NIL",
+	opTrue:         "TRUE",
+	opFalse:        "FALSE",
+	opPop:          "POP",
+	opGetLocal:     "GET_LOCAL",
+	opSetLocal:     "SET_LOCAL",
+	opGetGlobal:    "GET_GLOBAL",
+	opDefineGlobal: "DEFINE_GLOBAL",
+	opSetGlobal:    "SET_GLOBAL",
+	opGetUpvalue:   "GET_UPVALUE",
+	opSetUpvalue:   "SET_UPVALUE",
+	opGetProperty:  "GET_PROPERTY",
+	opSetProperty:  "SET_PROPERTY",
+	opGetSuper:     "GET_SUPER",
+	opEqual:        "EQUAL",
+	opGreater:      "GREATER",
+	opGreaterEqual: "GREATER_EQUAL",
+	opLess:         "LESS",
+	opLessEqual:    "LESS_EQUAL",
+	opAdd:          "ADD",
+	opSubtract:     "SUBTRACT",
+	opMultiply:     "MULTIPLY",
+	opDivide:       "DIVIDE",
+	opNot:          "NOT",
+	opNegate:       "NEGATE",
+	opPrint:        "PRINT",
+	opJump:         "JUMP",
+	opJumpIfFalse:  "JUMP_IF_FALSE",
+	opLoop:         "LOOP",
+	opCall:         "CALL",
+	opClosure:      "CLOSURE",
+	opCloseUpvalue: "CLOSE_UPVALUE",
+	opReturn:       "RETURN",
+	opClass:        "CLASS",
+	opInherit:      "INHERIT",
+	opMethod:       "METHOD",
+	opWide:         "WIDE",
+}
+
+func (op opCode) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return fmt.Sprintf("opCode(%d)", op)
+}
+
+// Chunk is the bytecode for one function: its code, the constants the code
+// refers to by index, and a line table giving the span of source each byte
+// of code was compiled from.
+type Chunk struct {
+	code      []byte
+	constants []Value
+	spans     []Span
+
+	constantIndex map[Value]int
+}
+
+func (c *Chunk) write(b byte, span Span) {
+	c.code = append(c.code, b)
+	c.spans = append(c.spans, span)
+}
+
+// addConstant returns the index of value in the constants pool, adding it if
+// it's not there already.
+func (c *Chunk) addConstant(value Value) int {
+	if c.constantIndex == nil {
+		c.constantIndex = make(map[Value]int)
+	}
+	if idx, ok := c.constantIndex[value]; ok {
+		return idx
+	}
+	c.constants = append(c.constants, value)
+	c.constantIndex[value] = len(c.constants) - 1
+	return len(c.constants) - 1
+}
+
+// line is the zero-based source line the byte at offset came from.
+func (c *Chunk) line(offset int) int {
+	return c.spans[offset].Start.Line
+}
+
+const (
+	slotSize     = 1
+	constantSize = 2
+	jumpSize     = 4
+	wideSize     = 4
+
+	// maxWide is the most a four byte operand holds while still fitting in an
+	// int everywhere.
+	maxWide = 1<<31 - 1
+)
+
+// fits is whether operand can be written in size bytes.
+func fits(operand, size int) bool {
+	return operand < 1<<(8*size)
+}
+
+// readOperand reads the size byte operand at offset.
+func (c *Chunk) readOperand(offset, size int) int {
+	operand := 0
+	for _, b := range c.code[offset : offset+size] {
+		operand = operand<<8 | int(b)
+	}
+	return operand
+}
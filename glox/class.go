@@ -0,0 +1,95 @@
+package glox
+
+import "fmt"
+
+type loxClass struct {
+	gcHeader
+	name       string
+	superclass *loxClass
+	methods    map[string]*loxFunction
+}
+
+func NewLoxClass(name string, superclass *loxClass, methods map[string]*loxFunction) *loxClass {
+	return &loxClass{
+		name:       name,
+		superclass: superclass,
+		methods:    methods,
+	}
+}
+
+// findMethod walks up the superclass chain so subclasses inherit any method
+// they don't override.
+func (c *loxClass) findMethod(name string) *loxFunction {
+	if method, ok := c.methods[name]; ok {
+		return method
+	}
+	if c.superclass != nil {
+		return c.superclass.findMethod(name)
+	}
+	return nil
+}
+
+func (c *loxClass) arity() int {
+	if initializer := c.findMethod("init"); initializer != nil {
+		return initializer.arity()
+	}
+	return 0
+}
+
+// call instantiates the class, running its initializer, if any, against the
+// new instance.
+func (c *loxClass) call(i *interpreter, arguments []Value) (Value, error) {
+	if err := i.allocate(instanceSize); err != nil {
+		return Nil, err
+	}
+
+	instance := NewLoxInstance(c)
+	i.gc.track(instance)
+	if initializer := c.findMethod("init"); initializer != nil {
+		bound := initializer.bind(instance)
+		i.gc.track(bound)
+		if _, err := bound.call(i, arguments); err != nil {
+			return Nil, err
+		}
+	}
+	return instanceValue(instance), nil
+}
+
+func (c *loxClass) String() string {
+	return c.name
+}
+
+type loxInstance struct {
+	gcHeader
+	class  *loxClass
+	fields map[string]Value
+}
+
+func NewLoxInstance(class *loxClass) *loxInstance {
+	return &loxInstance{
+		class:  class,
+		fields: make(map[string]Value),
+	}
+}
+
+// get looks up a field first so fields shadow methods, then falls back to a
+// method bound to this instance.
+func (li *loxInstance) get(name *Token) (Value, error) {
+	if value, ok := li.fields[name.lexeme]; ok {
+		return value, nil
+	}
+
+	if method := li.class.findMethod(name.lexeme); method != nil {
+		return functionValue(method.bind(li)), nil
+	}
+
+	return Nil, TokenRuntimeError(name, fmt.Errorf("Undefined property '%s'.", name.lexeme))
+}
+
+func (li *loxInstance) set(name *Token, value Value) {
+	li.fields[name.lexeme] = value
+}
+
+func (li *loxInstance) String() string {
+	return li.class.name + " instance"
+}
@@ -0,0 +1,186 @@
+package glox
+
+import "testing"
+
+func TestClassFieldsAndMethods(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	class Counter {
+		increment() {
+			this.count = this.count + 1;
+			return this;
+		}
+	}
+	var counter = Counter();
+	counter.count = 1;
+	var result = counter.increment().increment().count;
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	assertGlobal(interpreter, "result", NumberValue(3), t)
+}
+
+func TestClassInitializer(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	class Point {
+		init(x, y) {
+			this.x = x;
+			if (y == nil) return;
+			this.y = y;
+		}
+	}
+	var point = Point(1, 2);
+	var sum = point.x + point.y;
+	var reinit = point.init(5, nil);
+	var same = reinit == point;
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	assertGlobal(interpreter, "sum", NumberValue(3), t)
+	assertGlobal(interpreter, "same", BoolValue(true), t)
+}
+
+func TestBoundMethodsKeepTheirInstance(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	class Person {
+		init(name) { this.name = name; }
+		greet() { return "hi " + this.name; }
+	}
+	var greet = Person("jane").greet;
+	var result = greet();
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	assertGlobal(interpreter, "result", StringValue("hi jane"), t)
+}
+
+func TestClassStringification(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	class Bagel {}
+	var bagel = Bagel();
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	for name, expected := range map[string]string{"Bagel": "Bagel", "bagel": "Bagel instance"} {
+		value, _ := interpreter.globals.get(NewToken(IDENTIFIER, name, nil, 0))
+		if actual := value.String(); actual != expected {
+			t.Errorf("Expected: %s Actual: %s", expected, actual)
+		}
+	}
+}
+
+func TestClassRuntimeErrors(t *testing.T) {
+	testcases := map[string]string{
+		`class A {} A().missing;`:      "[Line 1] Error: Undefined property 'missing'.",
+		`var a = "str"; a.length;`:     "[Line 1] Error: Only instances have properties.",
+		`var a = "str"; a.length = 1;`: "[Line 1] Error: Only instances have fields.",
+		`class A { init(a) {} } A();`:  "[Line 1] Error: Expected 1 arguments but got 0.",
+	}
+
+	for source, expected := range testcases {
+		_, err := interpretedSource(source)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected: %s Actual: %v", expected, err)
+		}
+	}
+}
+
+func TestClassResolverErrors(t *testing.T) {
+	testcases := map[string]string{
+		`print this;`:                      "[Line 1] Error at 'this': Can't use 'this' outside of a class.",
+		`fun f() { return this; }`:         "[Line 1] Error at 'this': Can't use 'this' outside of a class.",
+		`class A { init() { return 1; } }`: "[Line 1] Error at 'return': Can't return a value from an initializer.",
+	}
+
+	for source, expected := range testcases {
+		_, err := interpretedSource(source)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected: %s Actual: %v", expected, err)
+		}
+	}
+}
+
+func TestInheritedMethodsAndSuperCalls(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	class A {
+		method() { return "A method"; }
+		name() { return "A"; }
+	}
+	class B < A {
+		method() { return "B method"; }
+		test() { return super.method(); }
+	}
+	class C < B {}
+	var inherited = C().name();
+	var overridden = C().method();
+	var viaSuper = C().test();
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	assertGlobal(interpreter, "inherited", StringValue("A"), t)
+	assertGlobal(interpreter, "overridden", StringValue("B method"), t)
+	assertGlobal(interpreter, "viaSuper", StringValue("A method"), t)
+}
+
+func TestInheritedInitializer(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	class Base { init(value) { this.value = value; } }
+	class Derived < Base {
+		init(value) {
+			super.init(value * 2);
+		}
+	}
+	var result = Derived(21).value;
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	assertGlobal(interpreter, "result", NumberValue(42), t)
+}
+
+func TestInheritanceErrors(t *testing.T) {
+	testcases := map[string]string{
+		"class A < A {}": "[Line 1] Error at 'A': A class can't inherit from itself.",
+		"var NotClass = 1;\nclass A < NotClass {}":                            "[Line 2] Error: Superclass must be a class.",
+		"super.method();":                                                     "[Line 1] Error at 'super': Can't use 'super' outside of a class.",
+		"class A { m() { super.m(); } }":                                      "[Line 1] Error at 'super': Can't use 'super' in a class with no superclass.",
+		"class A {}\nclass B < A { m() { return super.missing; } }\nB().m();": "[Line 2] Error: Undefined property 'missing'.",
+	}
+
+	for source, expected := range testcases {
+		_, err := interpretedSource(source)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected: %s Actual: %v", expected, err)
+		}
+	}
+}
+
+func TestObjectsEqualByIdentity(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	class A { init(x) { this.x = x; } }
+	var a = A(1);
+	var sameInstance = a == a;
+	var equalFields = A(1) == A(1);
+	fun make() { fun f() {} return f; }
+	var equalClosures = make() == make();
+	var boundTwice = a.init == a.init;
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	assertGlobal(interpreter, "sameInstance", BoolValue(true), t)
+	assertGlobal(interpreter, "equalFields", BoolValue(false), t)
+	assertGlobal(interpreter, "equalClosures", BoolValue(false), t)
+	assertGlobal(interpreter, "boundTwice", BoolValue(false), t)
+}
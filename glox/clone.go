@@ -0,0 +1,206 @@
+package glox
+
+// Clone makes an independent copy of the runtime, globals and all, with opts
+// applied on top of its settings. Loading shared definitions into one
+// runtime and cloning it for each goroutine is much cheaper than running the
+// same source again for each.
+//
+// Scripts in the clone can't see changes made in the original or the other
+// way round, with two exceptions: natives and host objects are shared, since
+// they belong to the host rather than the script. Clone only reads the
+// runtime, so any number of goroutines may clone one that isn't running.
+func (r *Runtime) Clone(opts ...RuntimeOption) *Runtime {
+	c := newCloner()
+	clone := &Runtime{
+		fileName:    r.fileName,
+		diagnostics: r.diagnostics,
+		stderr:      r.stderr,
+		engine:      r.engine,
+		interpreter: c.interpreter(r.interpreter),
+	}
+	if r.vm != nil {
+		clone.vm = c.vm(r.vm)
+	}
+	clone.configure(opts)
+	return clone
+}
+
+// cloner deep-copies interpreter state, remembering what it has already
+// copied so that values shared in the original are shared in the copy, and
+// cycles through closures and fields come out as cycles.
+type cloner struct {
+	environments map[*environment]*environment
+	values       map[interface{}]interface{}
+}
+
+func newCloner() *cloner {
+	return &cloner{
+		environments: make(map[*environment]*environment),
+		values:       make(map[interface{}]interface{}),
+	}
+}
+
+func (c *cloner) interpreter(i *interpreter) *interpreter {
+	globals := c.environment(i.globals)
+	return &interpreter{
+		globals:     globals,
+		environment: globals,
+		stdout:      i.stdout,
+		gc:          i.gc.clone(),
+		limits:      i.limits.clone(),
+	}
+}
+
+// vm copies a vm's globals. It's only cloned between runs, when every
+// upvalue has been closed and the stack is empty.
+func (c *cloner) vm(v *vm) *vm {
+	copied := NewVM()
+	for name, value := range v.globals {
+		copied.globals[name] = c.value(value)
+	}
+	return copied
+}
+
+func (c *cloner) environment(e *environment) *environment {
+	if e == nil {
+		return nil
+	}
+	if copied, ok := c.environments[e]; ok {
+		return copied
+	}
+
+	copied := &environment{values: make(map[string]Value, len(e.values))}
+	c.environments[e] = copied
+	copied.enclosing = c.environment(e.enclosing)
+	for name, value := range e.values {
+		copied.values[name] = c.value(value)
+	}
+	return copied
+}
+
+func (c *cloner) value(value Value) Value {
+	switch v := value.object().(type) {
+	case *loxFunction:
+		return functionValue(c.function(v))
+	case *loxClass:
+		return classValue(c.class(v))
+	case *loxInstance:
+		return instanceValue(c.instance(v))
+	case *closure:
+		return functionValue(c.closure(v))
+	case *boundMethod:
+		return functionValue(c.boundMethod(v))
+	case *vmClass:
+		return classValue(c.vmClass(v))
+	case *vmInstance:
+		return instanceValue(c.vmInstance(v))
+	default:
+		return value
+	}
+}
+
+func (c *cloner) function(f *loxFunction) *loxFunction {
+	if copied, ok := c.values[f]; ok {
+		return copied.(*loxFunction)
+	}
+
+	copied := &loxFunction{declaration: f.declaration, isInitializer: f.isInitializer}
+	c.values[f] = copied
+	copied.closure = c.environment(f.closure)
+	return copied
+}
+
+func (c *cloner) class(class *loxClass) *loxClass {
+	if copied, ok := c.values[class]; ok {
+		return copied.(*loxClass)
+	}
+
+	copied := &loxClass{name: class.name, methods: make(map[string]*loxFunction, len(class.methods))}
+	c.values[class] = copied
+	if class.superclass != nil {
+		copied.superclass = c.class(class.superclass)
+	}
+	for name, method := range class.methods {
+		copied.methods[name] = c.function(method)
+	}
+	return copied
+}
+
+func (c *cloner) instance(instance *loxInstance) *loxInstance {
+	if copied, ok := c.values[instance]; ok {
+		return copied.(*loxInstance)
+	}
+
+	copied := &loxInstance{fields: make(map[string]Value, len(instance.fields))}
+	c.values[instance] = copied
+	copied.class = c.class(instance.class)
+	for name, field := range instance.fields {
+		copied.fields[name] = c.value(field)
+	}
+	return copied
+}
+
+// closure copies a closure's upvalues; its function is compiled code, which
+// never changes, so the copy shares it.
+func (c *cloner) closure(cl *closure) *closure {
+	if copied, ok := c.values[cl]; ok {
+		return copied.(*closure)
+	}
+
+	copied := &closure{function: cl.function, upvalues: make([]*upvalue, len(cl.upvalues))}
+	c.values[cl] = copied
+	for idx, u := range cl.upvalues {
+		copied.upvalues[idx] = c.upvalue(u)
+	}
+	return copied
+}
+
+func (c *cloner) upvalue(u *upvalue) *upvalue {
+	if copied, ok := c.values[u]; ok {
+		return copied.(*upvalue)
+	}
+
+	copied := &upvalue{slot: u.slot, open: u.open}
+	c.values[u] = copied
+	copied.closed = c.value(u.closed)
+	return copied
+}
+
+func (c *cloner) boundMethod(b *boundMethod) *boundMethod {
+	if copied, ok := c.values[b]; ok {
+		return copied.(*boundMethod)
+	}
+
+	copied := &boundMethod{}
+	c.values[b] = copied
+	copied.receiver = c.vmInstance(b.receiver)
+	copied.method = c.closure(b.method)
+	return copied
+}
+
+func (c *cloner) vmClass(class *vmClass) *vmClass {
+	if copied, ok := c.values[class]; ok {
+		return copied.(*vmClass)
+	}
+
+	copied := &vmClass{name: class.name, methods: make(map[string]*closure, len(class.methods))}
+	c.values[class] = copied
+	for name, method := range class.methods {
+		copied.methods[name] = c.closure(method)
+	}
+	return copied
+}
+
+func (c *cloner) vmInstance(instance *vmInstance) *vmInstance {
+	if copied, ok := c.values[instance]; ok {
+		return copied.(*vmInstance)
+	}
+
+	copied := &vmInstance{fields: make(map[string]Value, len(instance.fields))}
+	c.values[instance] = copied
+	copied.class = c.vmClass(instance.class)
+	for name, field := range instance.fields {
+		copied.fields[name] = c.value(field)
+	}
+	return copied
+}
@@ -0,0 +1,139 @@
+package glox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+const preloaded = `
+fun makeCounter() {
+	var count = 0;
+	fun counter() {
+		count = count + 1;
+		return count;
+	}
+	return counter;
+}
+var counter = makeCounter();
+
+class Node {
+	init(name) { this.name = name; this.next = this; }
+	rename(name) { this.name = name; }
+}
+var node = Node("first");
+var alias = node;
+`
+
+func preloadedRuntime(t *testing.T, opts ...RuntimeOption) *Runtime {
+	runtime := New(opts...)
+	if _, err := runtime.Eval(context.Background(), preloaded); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return runtime
+}
+
+func evalString(t *testing.T, runtime *Runtime, source string) string {
+	value, err := runtime.Eval(context.Background(), source)
+	if err != nil {
+		t.Fatalf("%s: unexpected error %v", source, err)
+	}
+	return value.String()
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	base := preloadedRuntime(t)
+	evalString(t, base, "counter();")
+
+	clone := base.Clone()
+	evalString(t, clone, `counter(); node.rename("second"); var added = 1;`)
+
+	if actual := evalString(t, clone, "counter();"); actual != "3" {
+		t.Errorf("Expected the clone's counter to carry on from 1, got %s", actual)
+	}
+	if actual := evalString(t, base, "counter();"); actual != "2" {
+		t.Errorf("Expected the base counter not to see the clone's calls, got %s", actual)
+	}
+	if actual := evalString(t, base, "node.name;"); actual != "first" {
+		t.Errorf("Expected the base instance to be unchanged, got %s", actual)
+	}
+	if _, err := base.Eval(context.Background(), "added;"); err == nil {
+		t.Errorf("Expected globals defined in the clone not to appear in the base")
+	}
+}
+
+func TestClonePreservesSharingAndCycles(t *testing.T) {
+	clone := preloadedRuntime(t).Clone()
+
+	evalString(t, clone, `alias.rename("renamed");`)
+	if actual := evalString(t, clone, "node.name + node.next.name;"); actual != "renamedrenamed" {
+		t.Errorf("Expected aliases and cycles to still point at one instance, got %s", actual)
+	}
+	if actual := evalString(t, clone, "Node(\"new\").next.name;"); actual != "new" {
+		t.Errorf("Expected classes to work in the clone, got %s", actual)
+	}
+}
+
+func TestCloneAppliesOptions(t *testing.T) {
+	var stdout bytes.Buffer
+	clone := preloadedRuntime(t).Clone(WithStdout(&stdout), WithStepLimit(10))
+
+	evalString(t, clone, "print node.name;")
+	if stdout.String() != "first\n" {
+		t.Errorf("Expected the clone to print to its own stdout, got %q", stdout.String())
+	}
+	if _, err := clone.Eval(context.Background(), "while (true) {}"); err == nil {
+		t.Errorf("Expected the clone's step limit to apply")
+	}
+}
+
+func TestRunKeepsGlobals(t *testing.T) {
+	var stdout bytes.Buffer
+	runtime := New(WithStdout(&stdout))
+	for line, source := range []string{"var a = 1;", "a = a + 1;", "print a;"} {
+		if err := runtime.Run(source, line); err != nil {
+			t.Fatalf("%s: unexpected error %v", source, err)
+		}
+	}
+	if stdout.String() != "2\n" {
+		t.Errorf("Expected: 2 Actual: %q", stdout.String())
+	}
+}
+
+// TestClonesRunConcurrently is most useful under go test -race.
+func TestClonesRunConcurrently(t *testing.T) {
+	base := preloadedRuntime(t)
+
+	var wg sync.WaitGroup
+	results := make([]string, 16)
+	for n := range results {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			clone := base.Clone()
+
+			source := fmt.Sprintf(`
+			for (var i = 0; i < %d; i = i + 1) counter();
+			node.rename("clone");
+			counter();`, n)
+			value, err := clone.Eval(context.Background(), source)
+			if err != nil {
+				results[n] = err.Error()
+				return
+			}
+			results[n] = value.String()
+		}(n)
+	}
+	wg.Wait()
+
+	for n, result := range results {
+		if expected := fmt.Sprint(n + 1); result != expected {
+			t.Errorf("Clone %d: Expected: %s Actual: %s", n, expected, result)
+		}
+	}
+	if actual := evalString(t, base, "node.name;"); actual != "first" {
+		t.Errorf("Expected the base to be untouched by its clones, got %s", actual)
+	}
+}
@@ -0,0 +1,601 @@
+package glox
+
+import "errors"
+
+type local struct {
+	name       string
+	depth      int
+	isCaptured bool
+}
+
+type upvalueRef struct {
+	index   int
+	isLocal bool
+}
+
+type classCompiler struct {
+	enclosing     *classCompiler
+	hasSuperclass bool
+}
+
+// compiler turns the AST for one function into bytecode for the vm. Each
+// function nested in it gets a compiler of its own, which points back to this
+// one to find the variables it captures. The resolver has already rejected
+// programs that misuse variables, this, super and return, so the compiler
+// only has the limits of the bytecode format to check.
+type compiler struct {
+	enclosing  *compiler
+	function   *vmFunction
+	kind       functionType
+	locals     []local
+	upvalues   []upvalueRef
+	scopeDepth int
+	class      *classCompiler
+	errors     *[]error
+}
+
+func NewCompiler() *compiler {
+	return &compiler{
+		function: &vmFunction{chunk: &Chunk{}},
+		kind:     functionNone,
+		locals:   []local{{name: "", depth: 0}},
+		errors:   &[]error{},
+	}
+}
+
+// Compile compiles statements as the top level of a script. When the last of
+// them is an expression statement, the script returns its value, as Evaluate
+// does in the tree-walker.
+func (c *compiler) Compile(statements []Stmt) (*vmFunction, []error) {
+	var end Span
+	for idx, statement := range statements {
+		if stmt, ok := statement.(*Expression); ok && idx == len(statements)-1 {
+			c.expression(stmt.Expression)
+			c.emit(stmt.Span(), opReturn)
+			return c.function, *c.errors
+		}
+		c.statement(statement)
+		end = statement.Span()
+	}
+
+	c.emitReturn(end)
+	return c.function, *c.errors
+}
+
+func (c *compiler) visitExpressionStmt(stmt *Expression) (interface{}, error) {
+	c.expression(stmt.Expression)
+	c.emit(stmt.Span(), opPop)
+	return nil, nil
+}
+
+func (c *compiler) visitPrintStmt(stmt *Print) (interface{}, error) {
+	c.expression(stmt.Expression)
+	c.emit(stmt.Span(), opPrint)
+	return nil, nil
+}
+
+func (c *compiler) visitVarStmt(stmt *Var) (interface{}, error) {
+	c.declareVariable(stmt.Name)
+	if stmt.Initializer != nil {
+		c.expression(stmt.Initializer)
+	} else {
+		c.emit(stmt.Name.Span(), opNil)
+	}
+	c.defineVariable(stmt.Name)
+	return nil, nil
+}
+
+func (c *compiler) visitBlockStmt(stmt *Block) (interface{}, error) {
+	c.beginScope()
+	for _, statement := range stmt.Statements {
+		c.statement(statement)
+	}
+	c.endScope(stmt.Span())
+	return nil, nil
+}
+
+func (c *compiler) visitIfStmt(stmt *If) (interface{}, error) {
+	span := stmt.Condition.Span()
+	c.expression(stmt.Condition)
+
+	thenJump := c.emitJump(opJumpIfFalse, span)
+	c.emit(span, opPop)
+	c.statement(stmt.ThenBranch)
+	elseJump := c.emitJump(opJump, span)
+
+	c.patchJump(thenJump, span)
+	c.emit(span, opPop)
+	if stmt.ElseBranch != nil {
+		c.statement(stmt.ElseBranch)
+	}
+	c.patchJump(elseJump, span)
+	return nil, nil
+}
+
+func (c *compiler) visitWhileStmt(stmt *While) (interface{}, error) {
+	span := stmt.Condition.Span()
+	loopStart := len(c.chunk().code)
+	c.expression(stmt.Condition)
+
+	exitJump := c.emitJump(opJumpIfFalse, span)
+	c.emit(span, opPop)
+	c.statement(stmt.Body)
+	c.emitLoop(loopStart, span)
+
+	c.patchJump(exitJump, span)
+	c.emit(span, opPop)
+	return nil, nil
+}
+
+func (c *compiler) visitFunctionStmt(stmt *Function) (interface{}, error) {
+	c.declareVariable(stmt.Name)
+	c.markInitialized()
+	c.compileFunction(stmt, functionFunction)
+	c.defineVariable(stmt.Name)
+	return nil, nil
+}
+
+func (c *compiler) visitReturnStmt(stmt *Return) (interface{}, error) {
+	if stmt.Value == nil {
+		c.emitReturn(stmt.Span())
+		return nil, nil
+	}
+
+	c.expression(stmt.Value)
+	c.emit(stmt.Span(), opReturn)
+	return nil, nil
+}
+
+func (c *compiler) visitClassStmt(stmt *Class) (interface{}, error) {
+	name := stmt.Name
+	c.declareVariable(name)
+	c.emitOperand(name.Span(), opClass, c.identifierConstant(name.lexeme, name.Span()), constantSize)
+	c.defineVariable(name)
+
+	class := &classCompiler{enclosing: c.class}
+	c.class = class
+	defer func() { c.class = class.enclosing }()
+
+	if stmt.Superclass != nil {
+		superclass := stmt.Superclass.Name
+		c.namedVariable(superclass.lexeme, superclass.Span(), nil)
+
+		c.beginScope()
+		c.addLocal("super", superclass.Span())
+		c.markInitialized()
+
+		c.namedVariable(name.lexeme, name.Span(), nil)
+		c.emit(superclass.Span(), opInherit)
+		class.hasSuperclass = true
+	}
+
+	c.namedVariable(name.lexeme, name.Span(), nil)
+	for _, method := range stmt.Methods {
+		kind := functionMethod
+		if method.Name.lexeme == "init" {
+			kind = functionInitializer
+		}
+		c.compileFunction(method, kind)
+		c.emitOperand(method.Name.Span(), opMethod, c.identifierConstant(method.Name.lexeme, method.Name.Span()), constantSize)
+	}
+	c.emit(stmt.Span(), opPop)
+
+	if class.hasSuperclass {
+		c.endScope(stmt.Span())
+	}
+	return nil, nil
+}
+
+func (c *compiler) visitLiteralExpr(expr *Literal) (interface{}, error) {
+	switch expr.Value {
+	case nil:
+		c.emit(expr.Span(), opNil)
+	case true:
+		c.emit(expr.Span(), opTrue)
+	case false:
+		c.emit(expr.Span(), opFalse)
+	default:
+		value, _ := valueOf(expr.Value)
+		c.emitConstant(value, expr.Span())
+	}
+	return nil, nil
+}
+
+func (c *compiler) visitGroupingExpr(expr *Grouping) (interface{}, error) {
+	c.expression(expr.Expression)
+	return nil, nil
+}
+
+func (c *compiler) visitUnaryExpr(expr *Unary) (interface{}, error) {
+	c.expression(expr.Right)
+
+	switch expr.Operator.tokenType {
+	case MINUS:
+		c.emit(expr.Operator.Span(), opNegate)
+	case BANG:
+		c.emit(expr.Operator.Span(), opNot)
+	}
+	return nil, nil
+}
+
+var binaryOps = map[TokenType]opCode{
+	PLUS:          opAdd,
+	MINUS:         opSubtract,
+	STAR:          opMultiply,
+	SLASH:         opDivide,
+	GREATER:       opGreater,
+	GREATER_EQUAL: opGreaterEqual,
+	LESS:          opLess,
+	LESS_EQUAL:    opLessEqual,
+	EQUAL_EQUAL:   opEqual,
+	BANG_EQUAL:    opEqual,
+}
+
+func (c *compiler) visitBinaryExpr(expr *Binary) (interface{}, error) {
+	c.expression(expr.Left)
+	c.expression(expr.Right)
+
+	span := expr.Operator.Span()
+	c.emit(span, binaryOps[expr.Operator.tokenType])
+	if expr.Operator.tokenType == BANG_EQUAL {
+		c.emit(span, opNot)
+	}
+	return nil, nil
+}
+
+func (c *compiler) visitTernaryExpr(expr *Ternary) (interface{}, error) {
+	span := expr.LeftOperator.Span()
+	c.expression(expr.Left)
+
+	elseJump := c.emitJump(opJumpIfFalse, span)
+	c.emit(span, opPop)
+	c.expression(expr.Middle)
+	endJump := c.emitJump(opJump, span)
+
+	c.patchJump(elseJump, span)
+	c.emit(span, opPop)
+	c.expression(expr.Right)
+	c.patchJump(endJump, span)
+	return nil, nil
+}
+
+// visitLogicalExpr leaves the left operand on the stack as the result when
+// it decides the answer on its own.
+func (c *compiler) visitLogicalExpr(expr *Logical) (interface{}, error) {
+	span := expr.Operator.Span()
+	c.expression(expr.Left)
+
+	if expr.Operator.tokenType == OR {
+		elseJump := c.emitJump(opJumpIfFalse, span)
+		endJump := c.emitJump(opJump, span)
+		c.patchJump(elseJump, span)
+		c.emit(span, opPop)
+		c.expression(expr.Right)
+		c.patchJump(endJump, span)
+	} else {
+		endJump := c.emitJump(opJumpIfFalse, span)
+		c.emit(span, opPop)
+		c.expression(expr.Right)
+		c.patchJump(endJump, span)
+	}
+	return nil, nil
+}
+
+func (c *compiler) visitVariableExpr(expr *Variable) (interface{}, error) {
+	c.namedVariable(expr.Name.lexeme, expr.Name.Span(), nil)
+	return nil, nil
+}
+
+func (c *compiler) visitAssignExpr(expr *Assign) (interface{}, error) {
+	c.namedVariable(expr.Name.lexeme, expr.Name.Span(), expr.Value)
+	return nil, nil
+}
+
+// visitCallExpr records the span of the whole call against opCall: stack
+// traces show where calls start, and errors point at the closing paren,
+// which is always the end of it.
+func (c *compiler) visitCallExpr(expr *Call) (interface{}, error) {
+	c.expression(expr.Callee)
+	for _, argument := range expr.Arguments {
+		c.expression(argument)
+	}
+	c.emit(expr.Span(), opCall, byte(len(expr.Arguments)))
+	return nil, nil
+}
+
+func (c *compiler) visitGetExpr(expr *Get) (interface{}, error) {
+	c.expression(expr.Object)
+	c.emitOperand(expr.Name.Span(), opGetProperty, c.identifierConstant(expr.Name.lexeme, expr.Name.Span()), constantSize)
+	return nil, nil
+}
+
+func (c *compiler) visitSetExpr(expr *Set) (interface{}, error) {
+	c.expression(expr.Object)
+	c.expression(expr.Value)
+	c.emitOperand(expr.Name.Span(), opSetProperty, c.identifierConstant(expr.Name.lexeme, expr.Name.Span()), constantSize)
+	return nil, nil
+}
+
+func (c *compiler) visitThisExpr(expr *This) (interface{}, error) {
+	c.namedVariable("this", expr.Keyword.Span(), nil)
+	return nil, nil
+}
+
+func (c *compiler) visitSuperExpr(expr *Super) (interface{}, error) {
+	span := expr.Keyword.Span()
+	c.namedVariable("this", span, nil)
+	c.namedVariable("super", span, nil)
+	c.emitOperand(expr.Method.Span(), opGetSuper, c.identifierConstant(expr.Method.lexeme, expr.Method.Span()), constantSize)
+	return nil, nil
+}
+
+func (c *compiler) statement(stmt Stmt) {
+	stmt.Accept(c)
+}
+
+func (c *compiler) expression(expr Expr) {
+	expr.Accept(c)
+}
+
+// compileFunction compiles declaration with a compiler of its own, then
+// emits the code to make a closure of it here.
+func (c *compiler) compileFunction(declaration *Function, kind functionType) {
+	receiver := ""
+	if kind == functionMethod || kind == functionInitializer {
+		receiver = "this"
+	}
+
+	fc := &compiler{
+		enclosing: c,
+		function: &vmFunction{
+			name:  declaration.Name.lexeme,
+			arity: len(declaration.Params),
+			chunk: &Chunk{},
+		},
+		kind:   kind,
+		locals: []local{{name: receiver, depth: 0}},
+		class:  c.class,
+		errors: c.errors,
+	}
+
+	fc.beginScope()
+	for _, param := range declaration.Params {
+		fc.declareVariable(param)
+		fc.markInitialized()
+	}
+	for _, statement := range declaration.Body {
+		fc.statement(statement)
+	}
+	fc.emitReturn(declaration.Span())
+
+	function := fc.function
+	function.upvalueCount = len(fc.upvalues)
+
+	// The whole instruction is wide if the constant or any slot needs it.
+	span := declaration.Name.Span()
+	constant := c.makeConstant(functionValue(function), span)
+	constants, slots := constantSize, slotSize
+	wide := !fits(constant, constantSize)
+	for _, upvalue := range fc.upvalues {
+		wide = wide || !fits(upvalue.index, slotSize)
+	}
+	if wide {
+		c.emit(span, opWide)
+		constants, slots = wideSize, wideSize
+	}
+
+	c.emit(span, opClosure)
+	c.writeOperand(span, constant, constants)
+	for _, upvalue := range fc.upvalues {
+		isLocal := byte(0)
+		if upvalue.isLocal {
+			isLocal = 1
+		}
+		c.chunk().write(isLocal, span)
+		c.writeOperand(span, upvalue.index, slots)
+	}
+}
+
+func (c *compiler) namedVariable(name string, span Span, assignment Expr) {
+	getOp, setOp := opGetGlobal, opSetGlobal
+	arg := c.resolveLocal(name)
+	if arg != -1 {
+		getOp, setOp = opGetLocal, opSetLocal
+	} else if arg = c.resolveUpvalue(name, span); arg != -1 {
+		getOp, setOp = opGetUpvalue, opSetUpvalue
+	}
+
+	op := getOp
+	if assignment != nil {
+		c.expression(assignment)
+		op = setOp
+	}
+
+	if op == opGetGlobal || op == opSetGlobal {
+		c.emitOperand(span, op, c.identifierConstant(name, span), constantSize)
+	} else {
+		c.emitOperand(span, op, arg, slotSize)
+	}
+}
+
+func (c *compiler) declareVariable(name *Token) {
+	if c.scopeDepth == 0 {
+		return
+	}
+	c.addLocal(name.lexeme, name.Span())
+}
+
+func (c *compiler) addLocal(name string, span Span) {
+	if len(c.locals) > maxWide {
+		c.error(span, "Too many local variables in function")
+		return
+	}
+	c.locals = append(c.locals, local{name: name, depth: -1})
+}
+
+func (c *compiler) markInitialized() {
+	if c.scopeDepth == 0 {
+		return
+	}
+	c.locals[len(c.locals)-1].depth = c.scopeDepth
+}
+
+func (c *compiler) defineVariable(name *Token) {
+	if c.scopeDepth > 0 {
+		c.markInitialized()
+		return
+	}
+	c.emitOperand(name.Span(), opDefineGlobal, c.identifierConstant(name.lexeme, name.Span()), constantSize)
+}
+
+func (c *compiler) resolveLocal(name string) int {
+	for idx := len(c.locals) - 1; idx >= 0; idx-- {
+		if c.locals[idx].name == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// resolveUpvalue finds name in an enclosing function, capturing it in every
+// function in between so it's passed down closure by closure.
+func (c *compiler) resolveUpvalue(name string, span Span) int {
+	if c.enclosing == nil {
+		return -1
+	}
+
+	if slot := c.enclosing.resolveLocal(name); slot != -1 {
+		c.enclosing.locals[slot].isCaptured = true
+		return c.addUpvalue(slot, true, span)
+	}
+	if index := c.enclosing.resolveUpvalue(name, span); index != -1 {
+		return c.addUpvalue(index, false, span)
+	}
+	return -1
+}
+
+func (c *compiler) addUpvalue(index int, isLocal bool, span Span) int {
+	for idx, upvalue := range c.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return idx
+		}
+	}
+
+	if len(c.upvalues) > maxWide {
+		c.error(span, "Too many closure variables in function")
+		return 0
+	}
+	c.upvalues = append(c.upvalues, upvalueRef{index: index, isLocal: isLocal})
+	return len(c.upvalues) - 1
+}
+
+func (c *compiler) beginScope() {
+	c.scopeDepth++
+}
+
+// endScope pops the scope's locals off the stack, moving any that closures
+// captured off the stack and into their upvalues.
+func (c *compiler) endScope(span Span) {
+	c.scopeDepth--
+	for len(c.locals) > 0 && c.locals[len(c.locals)-1].depth > c.scopeDepth {
+		if c.locals[len(c.locals)-1].isCaptured {
+			c.emit(span, opCloseUpvalue)
+		} else {
+			c.emit(span, opPop)
+		}
+		c.locals = c.locals[:len(c.locals)-1]
+	}
+}
+
+func (c *compiler) chunk() *Chunk {
+	return c.function.chunk
+}
+
+func (c *compiler) emit(span Span, op opCode, operands ...byte) {
+	c.chunk().write(byte(op), span)
+	for _, operand := range operands {
+		c.chunk().write(operand, span)
+	}
+}
+
+// emitOperand emits op with an operand of size bytes, or makes it wide if
+// the operand doesn't fit.
+func (c *compiler) emitOperand(span Span, op opCode, operand, size int) {
+	if !fits(operand, size) {
+		c.emit(span, opWide)
+		size = wideSize
+	}
+	c.emit(span, op)
+	c.writeOperand(span, operand, size)
+}
+
+func (c *compiler) writeOperand(span Span, operand, size int) {
+	for shift := 8 * (size - 1); shift >= 0; shift -= 8 {
+		c.chunk().write(byte(operand>>shift), span)
+	}
+}
+
+// emitReturn returns from a function that's run off its end, or hit a bare
+// return. Initializers return this; everything else nil.
+func (c *compiler) emitReturn(span Span) {
+	if c.kind == functionInitializer {
+		c.emit(span, opGetLocal, 0)
+	} else {
+		c.emit(span, opNil)
+	}
+	c.emit(span, opReturn)
+}
+
+func (c *compiler) emitConstant(value Value, span Span) {
+	c.emitOperand(span, opConstant, c.makeConstant(value, span), constantSize)
+}
+
+func (c *compiler) makeConstant(value Value, span Span) int {
+	idx := c.chunk().addConstant(value)
+	if idx > maxWide {
+		c.error(span, "Too many constants in one chunk")
+		return 0
+	}
+	return idx
+}
+
+func (c *compiler) identifierConstant(name string, span Span) int {
+	return c.makeConstant(StringValue(name), span)
+}
+
+// emitJump emits a jump with a placeholder offset, and returns where the
+// offset is so patchJump can fill it in once it's known. How far a jump goes
+// isn't known until after it's emitted, so jumps are always four bytes.
+func (c *compiler) emitJump(op opCode, span Span) int {
+	c.emit(span, op)
+	c.writeOperand(span, -1, jumpSize)
+	return len(c.chunk().code) - jumpSize
+}
+
+func (c *compiler) patchJump(offset int, span Span) {
+	jump := len(c.chunk().code) - offset - jumpSize
+	if jump > maxWide {
+		c.error(span, "Too much code to jump over")
+	}
+	for idx := 0; idx < jumpSize; idx++ {
+		c.chunk().code[offset+idx] = byte(jump >> (8 * (jumpSize - 1 - idx)))
+	}
+}
+
+func (c *compiler) emitLoop(loopStart int, span Span) {
+	c.emit(span, opLoop)
+	offset := len(c.chunk().code) - loopStart + jumpSize
+	if offset > maxWide {
+		c.error(span, "Loop body too large")
+	}
+	c.writeOperand(span, offset, jumpSize)
+}
+
+func (c *compiler) error(span Span, msg string) {
+	*c.errors = append(*c.errors, &parseError{
+		line: span.Start.Line,
+		span: span,
+		code: codeCompile,
+		Err:  errors.New(msg),
+	})
+}
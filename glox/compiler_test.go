@@ -0,0 +1,116 @@
+package glox
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func compileSource(t *testing.T, source string) (*vmFunction, []error) {
+	tokens, errs := NewScanner(source).ScanTokens()
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected scan errors %v", errs)
+	}
+	statements, errs := NewParser(tokens).parse()
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected parse errors %v", errs)
+	}
+	return NewCompiler().Compile(statements)
+}
+
+func TestCompilerEmitsBytecode(t *testing.T) {
+	script, errs := compileSource(t, "print 1 + 2;")
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected errors %v", errs)
+	}
+
+	expected := []byte{
+		byte(opConstant), 0, 0,
+		byte(opConstant), 0, 1,
+		byte(opAdd),
+		byte(opPrint),
+		byte(opNil),
+		byte(opReturn),
+	}
+	if !reflect.DeepEqual(script.chunk.code, expected) {
+		t.Errorf("Expected: %v Actual: %v", expected, script.chunk.code)
+	}
+	if len(script.chunk.spans) != len(script.chunk.code) {
+		t.Errorf("Expected a span for every byte, got %d for %d", len(script.chunk.spans), len(script.chunk.code))
+	}
+}
+
+func TestCompilerSharesConstants(t *testing.T) {
+	script, errs := compileSource(t, `var a = "x"; var b = "x"; print a + b;`)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected errors %v", errs)
+	}
+
+	// "a", "x" and "b": the second "x" and the names read back are reused.
+	if len(script.chunk.constants) != 3 {
+		t.Errorf("Expected 3 constants, got %v", script.chunk.constants)
+	}
+}
+
+func TestCompilerRecordsLines(t *testing.T) {
+	script, _ := compileSource(t, "var a = 1;\n\nprint a;")
+
+	for offset, op := range script.chunk.code {
+		if opCode(op) == opPrint && script.chunk.line(offset) != 2 {
+			t.Errorf("Expected print on line 2, got %d", script.chunk.line(offset))
+		}
+	}
+}
+
+func TestCompilerReturnsLastExpression(t *testing.T) {
+	script, _ := compileSource(t, "1 + 2;")
+
+	code := script.chunk.code
+	if opCode(code[len(code)-1]) != opReturn || opCode(code[len(code)-2]) != opAdd {
+		t.Errorf("Expected the sum to be returned, got %v", code)
+	}
+}
+
+func TestCompilerWidensOperands(t *testing.T) {
+	var locals, constants, jumps strings.Builder
+
+	locals.WriteString("fun f() {\n")
+	for idx := 0; idx < 300; idx++ {
+		fmt.Fprintf(&locals, "var v%d = %d;\n", idx, idx)
+	}
+	locals.WriteString("v299 = v299 + 1; fun g() { return v299 + v0; } return g();\n}\nprint f();")
+
+	constants.WriteString("var sum = 0;\n")
+	for idx := 0; idx < 66000; idx++ {
+		fmt.Fprintf(&constants, "sum = sum + %d;\n", idx)
+	}
+	constants.WriteString("print sum;")
+
+	jumps.WriteString("var x = 0;\nif (true) {\n")
+	jumps.WriteString(strings.Repeat("x = x + 1;\n", 7000))
+	jumps.WriteString("}\nwhile (x < 14000) {\n")
+	jumps.WriteString(strings.Repeat("x = x + 1;\n", 7000))
+	jumps.WriteString("}\nprint x;")
+
+	testcases := map[string]string{
+		"locals":    locals.String(),
+		"constants": constants.String(),
+		"jumps":     jumps.String(),
+	}
+	for name, source := range testcases {
+		tree, vm := runBoth(source)
+		if strings.Contains(tree, "Error") || tree != vm {
+			t.Errorf("%s: Expected the vm to match the tree-walker\nTree:\n%s\nVM:\n%s", name, tree, vm)
+		}
+	}
+}
+
+func TestCompilerErrorsAreDiagnostics(t *testing.T) {
+	compiler := NewCompiler()
+	compiler.error(Span{}, "Too many constants in one chunk")
+
+	if code := DiagnosticFor((*compiler.errors)[0]).Code; code != codeCompile {
+		t.Errorf("Expected: %s Actual: %s", codeCompile, code)
+	}
+}
@@ -0,0 +1,313 @@
+package glox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// Error codes group diagnostics by the stage that produced them.
+const (
+	codeScan    = "E0001"
+	codeParse   = "E0002"
+	codeResolve = "E0003"
+	codeRuntime = "E0004"
+	codeCompile = "E0005"
+)
+
+// Diagnostic is everything needed to show an error to a person or a tool,
+// independent of how it ends up being displayed.
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Message  string
+	Span     Span
+	Hint     string
+	Note     string
+	Trace    []StackFrame
+}
+
+type DiagnosticFormat int
+
+const (
+	DiagnosticsText DiagnosticFormat = iota
+	DiagnosticsJSON
+	// DiagnosticsPlain is the bare format jlox uses, which the book's test
+	// suite expects.
+	DiagnosticsPlain
+)
+
+func ParseDiagnosticFormat(name string) (DiagnosticFormat, error) {
+	switch name {
+	case "text":
+		return DiagnosticsText, nil
+	case "json":
+		return DiagnosticsJSON, nil
+	case "plain":
+		return DiagnosticsPlain, nil
+	default:
+		return DiagnosticsText, fmt.Errorf("unknown diagnostics format '%s', expected 'text', 'json' or 'plain'", name)
+	}
+}
+
+type diagnosable interface {
+	Diagnostic() Diagnostic
+}
+
+// DiagnosticFor describes any error; errors that don't know their location
+// are given an empty span.
+func DiagnosticFor(err error) Diagnostic {
+	if d, ok := err.(diagnosable); ok {
+		return d.Diagnostic()
+	}
+	return Diagnostic{Severity: SeverityError, Message: strings.TrimSpace(err.Error())}
+}
+
+type diagnosticReporter interface {
+	report(d Diagnostic, fileName, source string)
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[1;31m"
+	ansiBlue  = "\x1b[1;34m"
+)
+
+// diagnosticRenderer prints diagnostics in the style of rustc: a headline,
+// the offending source line, and carets underneath the span. Lines and
+// columns are shown counting from one, the way editors do.
+type diagnosticRenderer struct {
+	out    io.Writer
+	colour bool
+}
+
+func NewDiagnosticRenderer(out io.Writer, colour bool) *diagnosticRenderer {
+	return &diagnosticRenderer{
+		out:    out,
+		colour: colour,
+	}
+}
+
+func (dr *diagnosticRenderer) report(d Diagnostic, fileName, source string) {
+	var sb strings.Builder
+
+	headline := d.Severity.String()
+	if d.Code != "" {
+		headline += "[" + d.Code + "]"
+	}
+	sb.WriteString(dr.paint(ansiRed, headline))
+	sb.WriteString(dr.paint(ansiBold, ": "+d.Message))
+	sb.WriteString("\n")
+
+	lineNumber := strconv.Itoa(d.Span.Start.Line + 1)
+	gutter := strings.Repeat(" ", len(lineNumber))
+
+	location := fmt.Sprintf("%d:%d", d.Span.Start.Line+1, d.Span.Start.Column+1)
+	if fileName != "" {
+		location = fileName + ":" + location
+	}
+	sb.WriteString(fmt.Sprintf("%s%s %s\n", gutter, dr.paint(ansiBlue, "-->"), location))
+	sb.WriteString(dr.paint(ansiBlue, gutter+" |") + "\n")
+
+	line := sourceLine(source, d.Span.Start.Line)
+	sb.WriteString(dr.paint(ansiBlue, lineNumber+" |") + " " + line + "\n")
+	sb.WriteString(dr.paint(ansiBlue, gutter+" |") + " " + dr.underline(line, d.Span) + "\n")
+
+	if d.Hint != "" {
+		sb.WriteString(fmt.Sprintf("%s %s %s\n", gutter, dr.paint(ansiBlue, "="), dr.paint(ansiBold, "hint:")+" "+d.Hint))
+	}
+	if d.Note != "" {
+		sb.WriteString(fmt.Sprintf("%s %s %s\n", gutter, dr.paint(ansiBlue, "="), dr.paint(ansiBold, "note:")+" "+d.Note))
+	}
+	if len(d.Trace) > 0 {
+		sb.WriteString(fmt.Sprintf("%s %s %s\n", gutter, dr.paint(ansiBlue, "="), dr.paint(ansiBold, "stack trace:")))
+		for _, frame := range d.Trace {
+			sb.WriteString(fmt.Sprintf("%s     %s\n", gutter, frame.format(fileName)))
+		}
+	}
+
+	fmt.Fprint(dr.out, sb.String())
+}
+
+// underline puts carets under the part of line covered by span. A span that
+// carries on past the line is underlined to the end of it, and an empty span
+// still gets a single caret.
+func (dr *diagnosticRenderer) underline(line string, span Span) string {
+	start := span.Start.Column
+	if start > len(line) {
+		start = len(line)
+	}
+
+	end := span.End.Column
+	if span.End.Line != span.Start.Line || end > len(line) {
+		end = len(line)
+	}
+	width := end - start
+	if width < 1 {
+		width = 1
+	}
+
+	// Copy tabs from the source so the carets line up however wide the
+	// terminal draws them.
+	var padding strings.Builder
+	for _, c := range line[:start] {
+		if c == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+
+	return padding.String() + dr.paint(ansiRed, strings.Repeat("^", width))
+}
+
+func (dr *diagnosticRenderer) paint(colour, text string) string {
+	if !dr.colour {
+		return text
+	}
+	return colour + text + ansiReset
+}
+
+// jsonReporter writes one JSON object per diagnostic, one per line, for
+// tools to consume. Lines and columns count from one as they do when
+// rendered for people; offsets are zero-based byte offsets into the source.
+type jsonReporter struct {
+	encoder *json.Encoder
+}
+
+type jsonPosition struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonSpan struct {
+	Start jsonPosition `json:"start"`
+	End   jsonPosition `json:"end"`
+}
+
+type jsonStackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+type jsonDiagnostic struct {
+	File     string           `json:"file"`
+	Line     int              `json:"line"`
+	Column   int              `json:"column"`
+	Span     jsonSpan         `json:"span"`
+	Severity string           `json:"severity"`
+	Code     string           `json:"code"`
+	Message  string           `json:"message"`
+	Hint     string           `json:"hint,omitempty"`
+	Note     string           `json:"note,omitempty"`
+	Trace    []jsonStackFrame `json:"trace,omitempty"`
+}
+
+func NewJSONReporter(out io.Writer) *jsonReporter {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	return &jsonReporter{
+		encoder: encoder,
+	}
+}
+
+func (jr *jsonReporter) report(d Diagnostic, fileName, source string) {
+	var trace []jsonStackFrame
+	for _, frame := range d.Trace {
+		position := toJSONPosition(frame.Position)
+		trace = append(trace, jsonStackFrame{frame.Function, fileName, position.Line, position.Column})
+	}
+
+	start := toJSONPosition(d.Span.Start)
+	jr.encoder.Encode(jsonDiagnostic{
+		File:     fileName,
+		Line:     start.Line,
+		Column:   start.Column,
+		Span:     jsonSpan{start, toJSONPosition(d.Span.End)},
+		Severity: d.Severity.String(),
+		Code:     d.Code,
+		Message:  d.Message,
+		Hint:     d.Hint,
+		Note:     d.Note,
+		Trace:    trace,
+	})
+}
+
+// plainReporter writes diagnostics the way jlox does. Errors in the source
+// are a single "[line N] Error at 'x': message" line, naming the text the
+// span covers, and runtime errors are the message with "[line N]" on the
+// line after it. Hints, notes and traces are left out.
+type plainReporter struct {
+	out io.Writer
+}
+
+func NewPlainReporter(out io.Writer) *plainReporter {
+	return &plainReporter{
+		out: out,
+	}
+}
+
+func (pr *plainReporter) report(d Diagnostic, fileName, source string) {
+	line := d.Span.Start.Line + 1
+
+	switch d.Code {
+	case "", codeRuntime:
+		fmt.Fprintf(pr.out, "%s\n[line %d]\n", d.Message, line)
+	case codeScan:
+		fmt.Fprintf(pr.out, "[line %d] Error: %s\n", line, d.Message)
+	default:
+		where := " at end"
+		if start, end := d.Span.Start.Offset, d.Span.End.Offset; start < end && end <= len(source) {
+			where = fmt.Sprintf(" at '%s'", source[start:end])
+		}
+		fmt.Fprintf(pr.out, "[line %d] Error%s: %s\n", line, where, d.Message)
+	}
+}
+
+func toJSONPosition(p Position) jsonPosition {
+	return jsonPosition{Offset: p.Offset, Line: p.Line + 1, Column: p.Column + 1}
+}
+
+func sourceLine(source string, line int) string {
+	lines := strings.Split(source, "\n")
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line], "\r")
+}
+
+// isTerminal reports whether f is attached to a terminal, and so whether
+// it's worth colouring output. Setting NO_COLOR turns colour off regardless.
+func isTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
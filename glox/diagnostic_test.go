@@ -0,0 +1,182 @@
+package glox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRenderRuntimeError(t *testing.T) {
+	source := "var a = 1;\nprint a + \"one\";"
+	_, err := interpretedSource(source)
+
+	expected := strings.Join([]string{
+		"error[E0004]: Operands must be two numbers or two strings.",
+		" --> 2:9",
+		"  |",
+		"2 | print a + \"one\";",
+		"  |         ^",
+		"",
+	}, "\n")
+	assertRendered(err, source, expected, t)
+}
+
+func TestRenderHintAndMultilineSpan(t *testing.T) {
+	source := "print \"never\nclosed"
+	_, errs := NewScanner(source).ScanTokens()
+
+	expected := strings.Join([]string{
+		"error[E0001]: Unterminated string.",
+		" --> 1:7",
+		"  |",
+		"1 | print \"never",
+		"  |       ^^^^^^",
+		"  = hint: add a closing '\"' to end the string",
+		"",
+	}, "\n")
+	assertRendered(errs[0], source, expected, t)
+}
+
+func TestRenderKeepsTabsAligned(t *testing.T) {
+	source := "{\n\tvar a = a;\n}"
+	_, err := interpretedSource(source)
+
+	expected := strings.Join([]string{
+		"error[E0003]: Can't read local variable in its own initializer.",
+		" --> 2:10",
+		"  |",
+		"2 | \tvar a = a;",
+		"  | \t        ^",
+		"  = hint: give the new variable a different name if you meant the outer one",
+		"",
+	}, "\n")
+	assertRendered(err, source, expected, t)
+}
+
+func TestRenderWideGutter(t *testing.T) {
+	source := strings.Repeat("\n", 11) + "print ;"
+	_, errs := NewParser(scanSource(source, t)).parse()
+
+	expected := strings.Join([]string{
+		"error[E0002]: Expect expression.",
+		"  --> 12:7",
+		"   |",
+		"12 | print ;",
+		"   |       ^",
+		"",
+	}, "\n")
+	assertRendered(errs[0], source, expected, t)
+}
+
+func TestRenderColour(t *testing.T) {
+	buf := bytes.Buffer{}
+	NewDiagnosticRenderer(&buf, true).report(DiagnosticFor(errors.New("plain")), "", "")
+
+	if !strings.HasPrefix(buf.String(), ansiRed+"error"+ansiReset) {
+		t.Errorf("Expected the headline to be coloured, got %q", buf.String())
+	}
+}
+
+func TestDiagnosticForPlainError(t *testing.T) {
+	d := DiagnosticFor(errors.New("something broke\n"))
+	if d.Severity != SeverityError || d.Code != "" || d.Message != "something broke" {
+		t.Errorf("Unexpected diagnostic for a plain error: %+v", d)
+	}
+}
+
+func TestRenderFileName(t *testing.T) {
+	buf := bytes.Buffer{}
+	_, errs := NewScanner("@").ScanTokens()
+	NewDiagnosticRenderer(&buf, false).report(DiagnosticFor(errs[0]), "script.lox", "@")
+
+	if !strings.Contains(buf.String(), " --> script.lox:1:1\n") {
+		t.Errorf("Expected the location to include the file name, got:\n%s", buf.String())
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	source := "var a = 1;\nprint a + \"one\";"
+	_, err := interpretedSource(source)
+
+	buf := bytes.Buffer{}
+	reporter := NewJSONReporter(&buf)
+	reporter.report(DiagnosticFor(err), "script.lox", source)
+	reporter.report(DiagnosticFor(undefinedVariable(NewToken(IDENTIFIER, "b", nil, 0))), "script.lox", source)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one JSON object per line, got:\n%s", buf.String())
+	}
+
+	expected := `{"file":"script.lox","line":2,"column":9,` +
+		`"span":{"start":{"offset":19,"line":2,"column":9},"end":{"offset":20,"line":2,"column":10}},` +
+		`"severity":"error","code":"E0004",` +
+		`"message":"Operands must be two numbers or two strings."}`
+	if lines[0] != expected {
+		t.Errorf("JSON diagnostic incorrect.\n\nExpected: %s\nGot: %s", expected, lines[0])
+	}
+
+	var decoded jsonDiagnostic
+	if err := json.Unmarshal([]byte(lines[1]), &decoded); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	if decoded.Hint != "declare it first with 'var b'" {
+		t.Errorf("Expected the hint to be included, got %+v", decoded)
+	}
+}
+
+func TestPlainReporter(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{
+			"print @;\nvar = 1;\nprint 1",
+			"[line 1] Error: Unexpected character.\n" +
+				"[line 1] Error at ';': Expect expression.\n" +
+				"[line 2] Error at '=': Expect variable name.\n" +
+				"[line 3] Error at end: Expect ';' after value.\n",
+		},
+		{
+			"print 1;\nprint missing;",
+			"Undefined variable 'missing'.\n[line 2]\n",
+		},
+	}
+
+	for _, test := range tests {
+		stderr := bytes.Buffer{}
+		runtime := New(WithDiagnostics(DiagnosticsPlain), WithStderr(&stderr), WithStdout(&bytes.Buffer{}))
+		if err := runtime.Run(test.source, 0); err == nil {
+			t.Errorf("Expected %q to fail", test.source)
+		}
+		if stderr.String() != test.expected {
+			t.Errorf("Plain diagnostics incorrect.\n\nExpected:\n%s\nGot:\n%s", test.expected, stderr.String())
+		}
+	}
+}
+
+func TestParseDiagnosticFormat(t *testing.T) {
+	for name, expected := range map[string]DiagnosticFormat{"text": DiagnosticsText, "json": DiagnosticsJSON, "plain": DiagnosticsPlain} {
+		if format, err := ParseDiagnosticFormat(name); err != nil || format != expected {
+			t.Errorf("Expected '%s' to parse, got %v, %v", name, format, err)
+		}
+	}
+
+	if _, err := ParseDiagnosticFormat("xml"); err == nil {
+		t.Errorf("Expected an unknown format to be rejected")
+	}
+}
+
+func assertRendered(err error, source, expected string, t *testing.T) {
+	if err == nil {
+		t.Fatalf("Expected an error to render")
+	}
+
+	buf := bytes.Buffer{}
+	NewDiagnosticRenderer(&buf, false).report(DiagnosticFor(err), "", source)
+	if buf.String() != expected {
+		t.Errorf("Rendered diagnostic incorrect.\n\nExpected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
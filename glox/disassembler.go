@@ -0,0 +1,147 @@
+package glox
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// disassembler writes bytecode out for people to read: one instruction per
+// line with its offset and operands, under the line of source it came from.
+// Temporaries live on the vm's stack and aren't named; local slots, constants
+// and jump targets are. It writes out the IR the same way, with labels in
+// place of offsets.
+type disassembler struct {
+	w     io.Writer
+	lines []string
+}
+
+// NewDisassembler writes to w. source is what the code was compiled from,
+// for listing its lines; without it only line numbers are shown.
+func NewDisassembler(w io.Writer, source string) *disassembler {
+	var lines []string
+	if source != "" {
+		lines = strings.Split(source, "\n")
+	}
+	return &disassembler{w: w, lines: lines}
+}
+
+// function writes out the code for f, then for each function f defines.
+func (d *disassembler) function(f *vmFunction) {
+	fmt.Fprintf(d.w, "== %s ==\n", f)
+
+	chunk := f.chunk
+	line := -1
+	for offset := 0; offset < len(chunk.code); {
+		if chunk.line(offset) != line {
+			line = chunk.line(offset)
+			d.sourceLine(line)
+		}
+		offset = d.instruction(chunk, offset)
+	}
+
+	for _, constant := range chunk.constants {
+		if nested, ok := constant.object().(*vmFunction); ok {
+			fmt.Fprintln(d.w)
+			d.function(nested)
+		}
+	}
+}
+
+// ir writes out f, lowered to the IR, then each function f defines.
+func (d *disassembler) ir(f *irFunction) {
+	fmt.Fprintf(d.w, "== %s ==\n", f)
+
+	line := -1
+	for _, instruction := range f.code {
+		if instruction.line != line {
+			line = instruction.line
+			d.sourceLine(line)
+		}
+		if instruction.op == irLabel {
+			fmt.Fprintln(d.w, instruction)
+		} else {
+			fmt.Fprintf(d.w, "     %s\n", instruction)
+		}
+	}
+
+	for _, nested := range f.functions {
+		fmt.Fprintln(d.w)
+		d.ir(nested)
+	}
+}
+
+func (d *disassembler) sourceLine(line int) {
+	if line < len(d.lines) {
+		fmt.Fprintf(d.w, "%4d | %s\n", line+1, strings.TrimSpace(d.lines[line]))
+	} else {
+		fmt.Fprintf(d.w, "%4d |\n", line+1)
+	}
+}
+
+// instruction writes out the instruction at offset and returns the offset of
+// the next one. A wide instruction is written as one, named "WIDE ...".
+func (d *disassembler) instruction(chunk *Chunk, offset int) int {
+	fmt.Fprintf(d.w, "%04d ", offset)
+
+	op, name := opCode(chunk.code[offset]), ""
+	constants, slots := constantSize, slotSize
+	if op == opWide {
+		offset++
+		op = opCode(chunk.code[offset])
+		name = "WIDE "
+		constants, slots = wideSize, wideSize
+	}
+	name += op.String()
+	operands := offset + 1
+
+	switch op {
+	case opConstant, opGetGlobal, opDefineGlobal, opSetGlobal, opGetProperty, opSetProperty,
+		opGetSuper, opClass, opMethod:
+		constant := chunk.readOperand(operands, constants)
+		fmt.Fprintf(d.w, "%-16s %4d '%s'\n", name, constant, chunk.constants[constant])
+		return operands + constants
+	case opGetLocal, opSetLocal, opGetUpvalue, opSetUpvalue:
+		fmt.Fprintf(d.w, "%-16s %4d\n", name, chunk.readOperand(operands, slots))
+		return operands + slots
+	case opCall:
+		fmt.Fprintf(d.w, "%-16s %4d\n", name, chunk.code[operands])
+		return operands + 1
+	case opJump, opJumpIfFalse:
+		next := operands + jumpSize
+		fmt.Fprintf(d.w, "%-16s %4d -> %d\n", name, offset, next+chunk.readOperand(operands, jumpSize))
+		return next
+	case opLoop:
+		next := operands + jumpSize
+		fmt.Fprintf(d.w, "%-16s %4d -> %d\n", name, offset, next-chunk.readOperand(operands, jumpSize))
+		return next
+	case opClosure:
+		constant := chunk.readOperand(operands, constants)
+		function := chunk.constants[constant].object().(*vmFunction)
+		fmt.Fprintf(d.w, "%-16s %4d '%s'\n", name, constant, function)
+
+		offset = operands + constants
+		for idx := 0; idx < function.upvalueCount; idx++ {
+			kind := "upvalue"
+			if chunk.code[offset] == 1 {
+				kind = "local"
+			}
+			fmt.Fprintf(d.w, "%04d |%-16s %4d %s\n", offset, "", chunk.readOperand(offset+1, slots), kind)
+			offset += 1 + slots
+		}
+		return offset
+	default:
+		fmt.Fprintln(d.w, name)
+		return operands
+	}
+}
+
+// stack writes out the values on the vm's stack, bottom first, as it's about
+// to run an instruction.
+func (d *disassembler) stack(stack []Value) {
+	fmt.Fprint(d.w, "          ")
+	for _, value := range stack {
+		fmt.Fprintf(d.w, "[ %s ]", value)
+	}
+	fmt.Fprintln(d.w)
+}
@@ -0,0 +1,112 @@
+package glox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDisassembler(t *testing.T) {
+	source := "var a = 1;\nif (a) print a + 2;"
+	script, errs := compileSource(t, source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected errors %v", errs)
+	}
+
+	var out bytes.Buffer
+	NewDisassembler(&out, source).function(script)
+
+	expected := `== <script> ==
+   1 | var a = 1;
+0000 CONSTANT            0 '1'
+0003 DEFINE_GLOBAL       1 'a'
+   2 | if (a) print a + 2;
+0006 GET_GLOBAL          1 'a'
+0009 JUMP_IF_FALSE       9 -> 28
+0014 POP
+0015 GET_GLOBAL          1 'a'
+0018 CONSTANT            2 '2'
+0021 ADD
+0022 PRINT
+0023 JUMP               23 -> 29
+0028 POP
+0029 NIL
+0030 RETURN
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nActual:\n%s", expected, out.String())
+	}
+}
+
+func TestDisassemblerNestedFunctions(t *testing.T) {
+	source := "fun outer() { var x = 1; fun inner() { return x; } return inner; }"
+	script, _ := compileSource(t, source)
+
+	var out bytes.Buffer
+	NewDisassembler(&out, source).function(script)
+
+	for _, expected := range []string{"== <fn outer> ==", "== <fn inner> ==", "1 local", "GET_UPVALUE"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestDisassemblerWideInstructions(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	for idx := 0; idx < 300; idx++ {
+		fmt.Fprintf(&sb, "var v%d;\n", idx)
+	}
+	sb.WriteString("v299 = 1; fun f() { return v299; } }")
+	source := sb.String()
+	script, errs := compileSource(t, source)
+	if len(errs) > 0 {
+		t.Fatalf("Unexpected errors %v", errs)
+	}
+
+	var out bytes.Buffer
+	NewDisassembler(&out, source).function(script)
+
+	for _, expected := range []string{"WIDE SET_LOCAL    300", "WIDE CLOSURE", "300 local"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestRuntimeDumpIR(t *testing.T) {
+	var out, stderr bytes.Buffer
+	runtime := New(WithStdout(&out), WithStderr(&stderr))
+	if err := runtime.DumpIR(&out, `print "dumped";`); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if strings.Contains(out.String(), "dumped\n") || !strings.Contains(out.String(), "print t0\n") {
+		t.Errorf("Expected the code to be dumped and not run, got:\n%s", out.String())
+	}
+
+	if err := runtime.DumpIR(io.Discard, "print ;"); err == nil {
+		t.Errorf("Expected a parse error")
+	}
+	if !strings.Contains(stderr.String(), "error[E0002]") {
+		t.Errorf("Expected the parse error to be reported, got:\n%s", stderr.String())
+	}
+}
+
+func TestTraceExec(t *testing.T) {
+	var out, trace bytes.Buffer
+	runtime := New(WithEngine(EngineVM), WithStdout(&out), WithTraceExec(&trace))
+	if _, err := runtime.Eval(context.Background(), "print 1 + 2;"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if out.String() != "3\n" {
+		t.Errorf("Expected: 3 Actual: %s", out.String())
+	}
+	if !strings.Contains(trace.String(), "[ <script> ][ 1 ][ 2 ]\n0006 ADD\n") {
+		t.Errorf("Expected the stack before the add, got:\n%s", trace.String())
+	}
+}
@@ -0,0 +1,67 @@
+package glox
+
+import "fmt"
+
+type environment struct {
+	gcHeader
+	enclosing *environment
+	values    map[string]Value
+}
+
+func NewEnvironment(enclosing *environment) *environment {
+	return &environment{
+		enclosing: enclosing,
+		values:    make(map[string]Value),
+	}
+}
+
+func (e *environment) define(name string, value Value) {
+	e.values[name] = value
+}
+
+func (e *environment) get(name *Token) (Value, error) {
+	if value, ok := e.values[name.lexeme]; ok {
+		return value, nil
+	}
+
+	if e.enclosing != nil {
+		return e.enclosing.get(name)
+	}
+
+	return Nil, undefinedVariable(name)
+}
+
+func (e *environment) assign(name *Token, value Value) error {
+	if _, ok := e.values[name.lexeme]; ok {
+		e.values[name.lexeme] = value
+		return nil
+	}
+
+	if e.enclosing != nil {
+		return e.enclosing.assign(name, value)
+	}
+
+	return undefinedVariable(name)
+}
+
+func (e *environment) getAt(distance int, name string) Value {
+	return e.ancestor(distance).values[name]
+}
+
+func (e *environment) assignAt(distance int, name *Token, value Value) {
+	e.ancestor(distance).values[name.lexeme] = value
+}
+
+func (e *environment) ancestor(distance int) *environment {
+	env := e
+	for i := 0; i < distance; i++ {
+		env = env.enclosing
+	}
+	return env
+}
+
+func undefinedVariable(name *Token) *runtimeError {
+	err := TokenRuntimeError(name, fmt.Errorf("Undefined variable '%s'.", name.lexeme))
+	err.hint = fmt.Sprintf("declare it first with 'var %s'", name.lexeme)
+	return err
+}
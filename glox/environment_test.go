@@ -0,0 +1,68 @@
+package glox
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEnvironmentGetFromEnclosing(t *testing.T) {
+	globals := NewEnvironment(nil)
+	globals.define("a", NumberValue(1))
+	local := NewEnvironment(globals)
+
+	value, err := local.get(NewToken(IDENTIFIER, "a", nil, 0))
+	if err != nil {
+		t.Fatalf("Expected 'a' to be found in the enclosing environment, got %v", err)
+	}
+	if value != NumberValue(1) {
+		t.Errorf("Expected: %v Actual: %v", 1.0, value)
+	}
+}
+
+func TestEnvironmentShadowing(t *testing.T) {
+	globals := NewEnvironment(nil)
+	globals.define("a", StringValue("outer"))
+	local := NewEnvironment(globals)
+	local.define("a", StringValue("inner"))
+	name := NewToken(IDENTIFIER, "a", nil, 0)
+
+	if value, _ := local.get(name); value != StringValue("inner") {
+		t.Errorf("Expected inner value to shadow outer, got %v", value)
+	}
+	if value, _ := globals.get(name); value != StringValue("outer") {
+		t.Errorf("Expected outer value to be untouched, got %v", value)
+	}
+}
+
+func TestEnvironmentAssignEnclosing(t *testing.T) {
+	globals := NewEnvironment(nil)
+	globals.define("a", NumberValue(1))
+	local := NewEnvironment(globals)
+	name := NewToken(IDENTIFIER, "a", nil, 0)
+
+	if err := local.assign(name, NumberValue(2)); err != nil {
+		t.Fatalf("Expected assignment to succeed, got %v", err)
+	}
+	if value, _ := globals.get(name); value != NumberValue(2) {
+		t.Errorf("Expected assignment to reach the enclosing environment, got %v", value)
+	}
+}
+
+func TestEnvironmentUndefinedVariable(t *testing.T) {
+	env := NewEnvironment(nil)
+	name := NewToken(IDENTIFIER, "missing", nil, 3)
+
+	expected := "[Line 4] Error: Undefined variable 'missing'."
+	for _, err := range []error{
+		func() error { _, err := env.get(name); return err }(),
+		env.assign(name, NumberValue(1)),
+	} {
+		var rtErr *runtimeError
+		if !errors.As(err, &rtErr) {
+			t.Fatalf("Expected a runtimeError, got %v", err)
+		}
+		if rtErr.Error() != expected {
+			t.Errorf("Expected: %s Actual: %s", expected, rtErr.Error())
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package glox
 
 type Expr interface {
+	Node
 	Accept(VisitorExpr) (interface{}, error)
 }
 
@@ -10,16 +11,25 @@ type VisitorExpr interface {
 	visitLiteralExpr(*Literal) (interface{}, error)
 	visitUnaryExpr(*Unary) (interface{}, error)
 	visitTernaryExpr(*Ternary) (interface{}, error)
+	visitVariableExpr(*Variable) (interface{}, error)
+	visitAssignExpr(*Assign) (interface{}, error)
+	visitLogicalExpr(*Logical) (interface{}, error)
+	visitCallExpr(*Call) (interface{}, error)
+	visitGetExpr(*Get) (interface{}, error)
+	visitSetExpr(*Set) (interface{}, error)
+	visitThisExpr(*This) (interface{}, error)
+	visitSuperExpr(*Super) (interface{}, error)
 }
 
 type Binary struct {
+	node
 	Left     Expr
 	Operator *Token
 	Right    Expr
 }
 
 func NewBinary(left Expr, operator *Token, right Expr) Expr {
-	return &Binary{left, operator, right}
+	return &Binary{Left: left, Operator: operator, Right: right}
 }
 
 func (b *Binary) Accept(visitor VisitorExpr) (interface{}, error) {
@@ -27,11 +37,12 @@ func (b *Binary) Accept(visitor VisitorExpr) (interface{}, error) {
 }
 
 type Grouping struct {
+	node
 	Expression Expr
 }
 
 func NewGrouping(expression Expr) Expr {
-	return &Grouping{expression}
+	return &Grouping{Expression: expression}
 }
 
 func (g *Grouping) Accept(visitor VisitorExpr) (interface{}, error) {
@@ -39,11 +50,12 @@ func (g *Grouping) Accept(visitor VisitorExpr) (interface{}, error) {
 }
 
 type Literal struct {
+	node
 	Value interface{}
 }
 
 func NewLiteral(value interface{}) Expr {
-	return &Literal{value}
+	return &Literal{Value: value}
 }
 
 func (l *Literal) Accept(visitor VisitorExpr) (interface{}, error) {
@@ -51,12 +63,13 @@ func (l *Literal) Accept(visitor VisitorExpr) (interface{}, error) {
 }
 
 type Unary struct {
+	node
 	Operator *Token
 	Right    Expr
 }
 
 func NewUnary(operator *Token, right Expr) Expr {
-	return &Unary{operator, right}
+	return &Unary{Operator: operator, Right: right}
 }
 
 func (u *Unary) Accept(visitor VisitorExpr) (interface{}, error) {
@@ -64,6 +77,7 @@ func (u *Unary) Accept(visitor VisitorExpr) (interface{}, error) {
 }
 
 type Ternary struct {
+	node
 	Left          Expr
 	LeftOperator  *Token
 	Middle        Expr
@@ -72,9 +86,126 @@ type Ternary struct {
 }
 
 func NewTernary(left Expr, leftOperator *Token, middle Expr, rightOperator *Token, right Expr) Expr {
-	return &Ternary{left, leftOperator, middle, rightOperator, right}
+	return &Ternary{Left: left, LeftOperator: leftOperator, Middle: middle, RightOperator: rightOperator, Right: right}
 }
 
 func (t *Ternary) Accept(visitor VisitorExpr) (interface{}, error) {
 	return visitor.visitTernaryExpr(t)
 }
+
+type Variable struct {
+	node
+	resolution
+	Name *Token
+}
+
+func NewVariable(name *Token) Expr {
+	return &Variable{Name: name}
+}
+
+func (v *Variable) Accept(visitor VisitorExpr) (interface{}, error) {
+	return visitor.visitVariableExpr(v)
+}
+
+type Assign struct {
+	node
+	resolution
+	Name  *Token
+	Value Expr
+}
+
+func NewAssign(name *Token, value Expr) Expr {
+	return &Assign{Name: name, Value: value}
+}
+
+func (a *Assign) Accept(visitor VisitorExpr) (interface{}, error) {
+	return visitor.visitAssignExpr(a)
+}
+
+type Logical struct {
+	node
+	Left     Expr
+	Operator *Token
+	Right    Expr
+}
+
+func NewLogical(left Expr, operator *Token, right Expr) Expr {
+	return &Logical{Left: left, Operator: operator, Right: right}
+}
+
+func (l *Logical) Accept(visitor VisitorExpr) (interface{}, error) {
+	return visitor.visitLogicalExpr(l)
+}
+
+type Call struct {
+	node
+	Callee    Expr
+	Paren     *Token
+	Arguments []Expr
+}
+
+func NewCall(callee Expr, paren *Token, arguments []Expr) Expr {
+	return &Call{Callee: callee, Paren: paren, Arguments: arguments}
+}
+
+func (c *Call) Accept(visitor VisitorExpr) (interface{}, error) {
+	return visitor.visitCallExpr(c)
+}
+
+type Get struct {
+	node
+	Object Expr
+	Name   *Token
+}
+
+func NewGet(object Expr, name *Token) Expr {
+	return &Get{Object: object, Name: name}
+}
+
+func (g *Get) Accept(visitor VisitorExpr) (interface{}, error) {
+	return visitor.visitGetExpr(g)
+}
+
+type Set struct {
+	node
+	Object Expr
+	Name   *Token
+	Value  Expr
+}
+
+func NewSet(object Expr, name *Token, value Expr) Expr {
+	return &Set{Object: object, Name: name, Value: value}
+}
+
+func (s *Set) Accept(visitor VisitorExpr) (interface{}, error) {
+	return visitor.visitSetExpr(s)
+}
+
+type This struct {
+	node
+	resolution
+	Keyword *Token
+}
+
+func NewThis(keyword *Token) Expr {
+	return &This{Keyword: keyword}
+}
+
+func (t *This) Accept(visitor VisitorExpr) (interface{}, error) {
+	return visitor.visitThisExpr(t)
+}
+
+type Super struct {
+	node
+	resolution
+	Keyword *Token
+	Method  *Token
+}
+
+func NewSuper(keyword *Token, method *Token) Expr {
+	return &Super{Keyword: keyword, Method: method}
+}
+
+func (s *Super) Accept(visitor VisitorExpr) (interface{}, error) {
+	return visitor.visitSuperExpr(s)
+}
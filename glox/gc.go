@@ -0,0 +1,324 @@
+package glox
+
+const (
+	// defaultHeapGrowth is how much the heap may grow, as a multiple of what
+	// survived the last collection, before the next one runs.
+	defaultHeapGrowth = 2.0
+
+	// minHeapSize keeps small scripts from collecting over and over while
+	// their heap is tiny.
+	minHeapSize = 1 << 20
+
+	// Rough sizes the heap counts objects as, on top of instanceSize and
+	// fieldSize for instances and each field, variable or method.
+	environmentSize = 48
+	functionSize    = 48
+	classSize       = 64
+	upvalueSize     = 32
+	boundMethodSize = 32
+)
+
+// GCStats is what the garbage collector has done for a runtime so far, and
+// how big the heap is now.
+type GCStats struct {
+	// Collections is how many times the collector has run.
+	Collections int
+	// Allocated and Freed are how many objects have been added to the heap
+	// and swept out of it.
+	Allocated int
+	Freed     int
+	// Objects is how many objects are in the heap, and HeapSize roughly how
+	// many bytes they take up.
+	Objects  int
+	HeapSize int
+	// NextGC is the HeapSize at which the next collection runs.
+	NextGC int
+}
+
+// heapObject is anything a script creates that the collector looks after:
+// environments, functions, classes and instances in the tree-walker, and
+// closures, upvalues, classes, instances and bound methods in the vm.
+// Strings, natives and host objects aren't; nothing in them refers back to
+// the heap.
+type heapObject interface {
+	header() *gcHeader
+	size() int
+	// trace marks every object this one refers to.
+	trace(c *collector)
+}
+
+type gcHeader struct {
+	marked  bool
+	tracked bool
+}
+
+func (h *gcHeader) header() *gcHeader {
+	return h
+}
+
+// rootSet is an engine, which knows where the values it's using are.
+type rootSet interface {
+	markRoots(c *collector)
+}
+
+// collector is a mark-and-sweep garbage collector. Each engine tracks the
+// objects it creates and, at the points where it checks its limits, lets the
+// collector run once the heap has grown by the growth factor since the last
+// collection. Everything the engine's roots can reach is marked; everything
+// else is swept out of the heap.
+//
+// Go still owns the memory, and frees it once nothing refers to an object,
+// so sweeping doesn't touch the object itself. A Value the host held on to
+// stays usable, and is tracked again if it's handed back to the script.
+type collector struct {
+	objects    []heapObject
+	gray       []heapObject
+	heapSize   int
+	nextGC     int
+	growth     float64
+	stress     bool
+	collecting bool
+	stats      GCStats
+
+	// untracked counts objects found by marking that weren't being tracked:
+	// values from Clone or the host, or objects swept while the engine still
+	// had them, which means a root was missed.
+	untracked int
+}
+
+func newCollector() collector {
+	return collector{nextGC: minHeapSize, growth: defaultHeapGrowth}
+}
+
+// clone copies the collector's settings for another runtime, which starts
+// with an empty heap.
+func (c *collector) clone() collector {
+	clone := newCollector()
+	clone.growth, clone.stress = c.growth, c.stress
+	return clone
+}
+
+// track adds a new object to the heap, along with anything new it refers to,
+// so that a bound method brings the environment binding "this" with it.
+func (c *collector) track(object heapObject) {
+	c.markObject(object)
+	c.traceReferences()
+}
+
+// trackValue tracks the object value holds, if it's one the heap looks after.
+func (c *collector) trackValue(value Value) {
+	if object, ok := value.object().(heapObject); ok {
+		c.track(object)
+	}
+}
+
+// collectIfNeeded collects once the heap has outgrown nextGC, or every time
+// under stress.
+func (c *collector) collectIfNeeded(roots rootSet) {
+	if c.stress || c.heapSize > c.nextGC {
+		c.collect(roots)
+	}
+}
+
+func (c *collector) collect(roots rootSet) {
+	c.collecting = true
+	roots.markRoots(c)
+	c.traceReferences()
+	c.collecting = false
+	c.sweep()
+
+	c.nextGC = int(float64(c.heapSize) * c.growth)
+	if c.nextGC < minHeapSize {
+		c.nextGC = minHeapSize
+	}
+	c.stats.Collections++
+}
+
+// markObject marks an object while collecting, and only tracks it otherwise.
+// Either way it's left on the gray list for what it refers to to be traced.
+func (c *collector) markObject(object heapObject) {
+	h := object.header()
+	if h.marked || (!c.collecting && h.tracked) {
+		return
+	}
+	h.marked = c.collecting
+
+	if !h.tracked {
+		if c.collecting {
+			c.untracked++
+		}
+		h.tracked = true
+		c.objects = append(c.objects, object)
+		c.heapSize += object.size()
+		c.stats.Allocated++
+	}
+	c.gray = append(c.gray, object)
+}
+
+func (c *collector) markValue(value Value) {
+	if object, ok := value.object().(heapObject); ok {
+		c.markObject(object)
+	}
+}
+
+func (c *collector) traceReferences() {
+	for len(c.gray) > 0 {
+		object := c.gray[len(c.gray)-1]
+		c.gray = c.gray[:len(c.gray)-1]
+		object.trace(c)
+	}
+}
+
+// sweep drops everything left unmarked, and adds up the size of what's left,
+// which may have grown since it was tracked.
+func (c *collector) sweep() {
+	live := c.objects[:0]
+	c.heapSize = 0
+	for _, object := range c.objects {
+		h := object.header()
+		if h.marked {
+			h.marked = false
+			c.heapSize += object.size()
+			live = append(live, object)
+		} else {
+			h.tracked = false
+			c.stats.Freed++
+		}
+	}
+
+	for idx := len(live); idx < len(c.objects); idx++ {
+		c.objects[idx] = nil
+	}
+	c.objects = live
+}
+
+func (c *collector) statistics() GCStats {
+	stats := c.stats
+	stats.Objects = len(c.objects)
+	stats.HeapSize = c.heapSize
+	stats.NextGC = c.nextGC
+	return stats
+}
+
+func (i *interpreter) markRoots(c *collector) {
+	c.markObject(i.globals)
+	c.markObject(i.environment)
+	for _, env := range i.environments {
+		c.markObject(env)
+	}
+	for _, value := range i.stack {
+		c.markValue(value)
+	}
+}
+
+func (vm *vm) markRoots(c *collector) {
+	for _, value := range vm.stack {
+		c.markValue(value)
+	}
+	for _, frame := range vm.frames {
+		c.markObject(frame.closure)
+	}
+	for _, upvalue := range vm.openUpvalues {
+		c.markObject(upvalue)
+	}
+	for _, value := range vm.globals {
+		c.markValue(value)
+	}
+}
+
+func (e *environment) size() int {
+	return environmentSize + fieldSize*len(e.values)
+}
+
+func (e *environment) trace(c *collector) {
+	if e.enclosing != nil {
+		c.markObject(e.enclosing)
+	}
+	for _, value := range e.values {
+		c.markValue(value)
+	}
+}
+
+func (f *loxFunction) size() int {
+	return functionSize
+}
+
+func (f *loxFunction) trace(c *collector) {
+	c.markObject(f.closure)
+}
+
+func (class *loxClass) size() int {
+	return classSize + fieldSize*len(class.methods)
+}
+
+func (class *loxClass) trace(c *collector) {
+	if class.superclass != nil {
+		c.markObject(class.superclass)
+	}
+	for _, method := range class.methods {
+		c.markObject(method)
+	}
+}
+
+func (li *loxInstance) size() int {
+	return instanceSize + fieldSize*len(li.fields)
+}
+
+func (li *loxInstance) trace(c *collector) {
+	c.markObject(li.class)
+	for _, value := range li.fields {
+		c.markValue(value)
+	}
+}
+
+func (cl *closure) size() int {
+	return functionSize + fieldSize*len(cl.upvalues)
+}
+
+func (cl *closure) trace(c *collector) {
+	for _, upvalue := range cl.upvalues {
+		c.markObject(upvalue)
+	}
+}
+
+func (u *upvalue) size() int {
+	return upvalueSize
+}
+
+// trace marks the value an upvalue has closed over. While it's open the
+// value is on the stack, which is a root anyway.
+func (u *upvalue) trace(c *collector) {
+	if !u.open {
+		c.markValue(u.closed)
+	}
+}
+
+func (class *vmClass) size() int {
+	return classSize + fieldSize*len(class.methods)
+}
+
+func (class *vmClass) trace(c *collector) {
+	for _, method := range class.methods {
+		c.markObject(method)
+	}
+}
+
+func (i *vmInstance) size() int {
+	return instanceSize + fieldSize*len(i.fields)
+}
+
+func (i *vmInstance) trace(c *collector) {
+	c.markObject(i.class)
+	for _, value := range i.fields {
+		c.markValue(value)
+	}
+}
+
+func (b *boundMethod) size() int {
+	return boundMethodSize
+}
+
+func (b *boundMethod) trace(c *collector) {
+	c.markObject(b.receiver)
+	c.markObject(b.method)
+}
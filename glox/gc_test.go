@@ -0,0 +1,156 @@
+package glox
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// gcSource exercises everything the collector has to find its way to:
+// closures over locals, bound methods, superclasses, fields and values held
+// part way through evaluating an expression.
+const gcSource = `
+class Node {
+	init(value, next) { this.value = value; this.next = next; }
+	sum() { if (this.next == nil) return this.value; return this.value + this.next.sum(); }
+}
+class Counted < Node {
+	init(value, next) { super.init(value, next); this.label = "node"; }
+	describe() { var sum = super.sum; return this.value * 1000 + sum(); }
+}
+fun counter() { var n = 0; fun inc() { n = n + 1; return n; } return inc; }
+fun pair(a, b) { return a.value + b.value; }
+fun link(a, b) { b.next = a; return b; }
+
+var list = nil;
+var count = counter();
+for (var i = 0; i < 20; i = i + 1) {
+	list = Counted(count(), list);
+	var garbage = Node(i, Node(i, nil));
+}
+var method = list.sum;
+print method();
+print pair(Node(1, nil), Node(count(), nil));
+var linked = link(Node(1, nil), Node(count(), nil));
+print linked.sum();
+print Node(1, nil).value + Node(2, nil).sum();
+print list.describe();
+print list.label;
+`
+
+func collectorOf(r *Runtime) *collector {
+	if r.vm != nil {
+		return &r.vm.gc
+	}
+	return &r.interpreter.gc
+}
+
+func TestStressGCKeepsLiveObjects(t *testing.T) {
+	for _, engine := range []Engine{EngineTree, EngineVM} {
+		var expected, actual bytes.Buffer
+		New(WithEngine(engine), WithStdout(&expected)).Run(gcSource, 0)
+
+		runtime := New(WithEngine(engine), WithStdout(&actual), WithStressGC())
+		if err := runtime.Run(gcSource, 0); err != nil {
+			t.Fatalf("Engine %d: unexpected error %v", engine, err)
+		}
+		if actual.String() != expected.String() {
+			t.Errorf("Engine %d: Expected:\n%s\nActual:\n%s", engine, expected.String(), actual.String())
+		}
+
+		stats := runtime.GCStats()
+		if stats.Collections < 20 || stats.Freed == 0 {
+			t.Errorf("Engine %d: expected a collection at every loop iteration, got %+v", engine, stats)
+		}
+		if untracked := collectorOf(runtime).untracked; untracked != 0 {
+			t.Errorf("Engine %d: %d objects were swept while still in use", engine, untracked)
+		}
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	for _, engine := range []Engine{EngineTree, EngineVM} {
+		runtime := New(WithEngine(engine))
+		_, err := runtime.Eval(context.Background(), `
+		class Box {}
+		var kept = Box();
+		kept.inner = Box();
+		for (var i = 0; i < 100; i = i + 1) { Box(); }
+		`)
+		if err != nil {
+			t.Fatalf("Engine %d: unexpected error %v", engine, err)
+		}
+
+		before := runtime.GCStats()
+		runtime.CollectGarbage()
+		after := runtime.GCStats()
+
+		if after.Collections != before.Collections+1 {
+			t.Errorf("Engine %d: expected one more collection, got %+v", engine, after)
+		}
+		if freed := after.Freed - before.Freed; freed < 100 {
+			t.Errorf("Engine %d: expected the 100 unreachable boxes to be freed, got %d", engine, freed)
+		}
+		if after.Objects >= before.Objects || after.HeapSize >= before.HeapSize {
+			t.Errorf("Engine %d: expected the heap to shrink, before %+v after %+v", engine, before, after)
+		}
+
+		value, err := runtime.Eval(context.Background(), "kept.inner.field = 1; kept.inner.field;")
+		if err != nil || value != NumberValue(1) {
+			t.Errorf("Engine %d: expected the kept boxes to survive, got %v, %v", engine, value, err)
+		}
+	}
+}
+
+func TestHeapGrowth(t *testing.T) {
+	source := `
+	class Node {}
+	var head = nil;
+	for (var i = 0; i < 20000; i = i + 1) { var node = Node(); node.next = head; head = node; }
+	`
+	for _, engine := range []Engine{EngineTree, EngineVM} {
+		runtime := New(WithEngine(engine), WithHeapGrowth(3))
+		if _, err := runtime.Eval(context.Background(), source); err != nil {
+			t.Fatalf("Engine %d: unexpected error %v", engine, err)
+		}
+
+		runtime.CollectGarbage()
+		stats := runtime.GCStats()
+		if stats.HeapSize <= minHeapSize {
+			t.Fatalf("Engine %d: expected the list to outgrow the minimum heap, got %+v", engine, stats)
+		}
+		if stats.NextGC != stats.HeapSize*3 {
+			t.Errorf("Engine %d: expected the next collection at 3 times the heap, got %+v", engine, stats)
+		}
+	}
+}
+
+func TestCollectsAsHeapGrows(t *testing.T) {
+	source := `class Garbage {} for (var i = 0; i < 50000; i = i + 1) { Garbage().field = i; }`
+	for _, engine := range []Engine{EngineTree, EngineVM} {
+		runtime := New(WithEngine(engine))
+		if _, err := runtime.Eval(context.Background(), source); err != nil {
+			t.Fatalf("Engine %d: unexpected error %v", engine, err)
+		}
+
+		stats := runtime.GCStats()
+		if stats.Collections == 0 || stats.Objects >= 50000 || stats.Allocated < 50000 {
+			t.Errorf("Engine %d: expected the garbage to be collected along the way, got %+v", engine, stats)
+		}
+	}
+}
+
+func TestCloneKeepsGCSettings(t *testing.T) {
+	runtime := New(WithHeapGrowth(4), WithStressGC())
+	clone := runtime.Clone()
+	if c := collectorOf(clone); c.growth != 4 || !c.stress {
+		t.Errorf("Expected the clone to keep the collector's settings, got growth %v stress %v", c.growth, c.stress)
+	}
+
+	if _, err := clone.Eval(context.Background(), "class A {} var a = A(); a.b = A();"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if value, err := clone.Eval(context.Background(), "a.b;"); err != nil || value.String() != "A instance" {
+		t.Errorf("Expected a.b to survive, got %v, %v", value, err)
+	}
+}
@@ -0,0 +1,122 @@
+package glox
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// hostObject lets scripts use a pointer to a Go struct much like an instance:
+// its exported fields can be read and assigned, and its exported methods
+// called. Lox names are the Go names starting in lower case, so Config.Name
+// is config.name, unless a `lox:"..."` tag on a field says otherwise. A tag
+// of `lox:"-"` hides the field.
+type hostObject struct {
+	value reflect.Value
+}
+
+func newHostObject(value reflect.Value) *hostObject {
+	return &hostObject{value: value}
+}
+
+func (h *hostObject) get(name *Token) (Value, error) {
+	if field, ok := h.field(name.lexeme); ok {
+		value, err := hostValue(field)
+		if err != nil {
+			return Nil, TokenRuntimeError(name, fmt.Errorf("can't read '%s': %w", name.lexeme, err))
+		}
+		return value, nil
+	}
+
+	if method, ok := h.method(name.lexeme); ok {
+		native, err := reflectNative(name.lexeme, method)
+		if err != nil {
+			return Nil, TokenRuntimeError(name, fmt.Errorf("can't call '%s': %w", name.lexeme, err))
+		}
+		return functionValue(native), nil
+	}
+
+	return Nil, TokenRuntimeError(name, fmt.Errorf("Undefined property '%s'.", name.lexeme))
+}
+
+// set assigns to an existing field. Unlike an instance, a Go struct can't
+// grow new fields.
+func (h *hostObject) set(name *Token, value Value) error {
+	field, ok := h.field(name.lexeme)
+	if !ok {
+		return TokenRuntimeError(name, fmt.Errorf("%s has no field '%s'", h.typeName(), name.lexeme))
+	}
+
+	converted, err := fromLox(value, field.Type())
+	if err != nil {
+		return TokenRuntimeError(name, fmt.Errorf("can't assign '%s': %w", name.lexeme, err))
+	}
+	field.Set(converted)
+	return nil
+}
+
+func (h *hostObject) field(name string) (reflect.Value, bool) {
+	t := h.value.Elem().Type()
+	for idx := 0; idx < t.NumField(); idx++ {
+		f := t.Field(idx)
+		if f.PkgPath != "" {
+			continue
+		}
+		if fieldName(f) == name {
+			return h.value.Elem().Field(idx), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func (h *hostObject) method(name string) (reflect.Value, bool) {
+	t := h.value.Type()
+	for idx := 0; idx < t.NumMethod(); idx++ {
+		if loxName(t.Method(idx).Name) == name {
+			return h.value.Method(idx), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// same is whether two host objects share the same Go struct.
+func (h *hostObject) same(other *hostObject) bool {
+	return h.value.Type() == other.value.Type() && h.value.Pointer() == other.value.Pointer()
+}
+
+func (h *hostObject) typeName() string {
+	return h.value.Elem().Type().Name()
+}
+
+// String uses the struct's own String method if it has one, and otherwise
+// reads like an instance of a Lox class.
+func (h *hostObject) String() string {
+	if s, ok := h.value.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	return h.typeName() + " instance"
+}
+
+// hostValue converts a struct field to a Lox value. Nested structs are shared
+// with the Go side rather than copied, so assigning to their fields from Lox
+// is seen by the host.
+func hostValue(field reflect.Value) (Value, error) {
+	if field.Kind() == reflect.Struct && field.CanAddr() {
+		return Value{kind: HostKind, ref: newHostObject(field.Addr())}, nil
+	}
+	return ValueOf(field.Interface())
+}
+
+func fieldName(f reflect.StructField) string {
+	if tag, ok := f.Tag.Lookup("lox"); ok {
+		return strings.Split(tag, ",")[0]
+	}
+	return loxName(f.Name)
+}
+
+func loxName(goName string) string {
+	r, size := utf8.DecodeRuneInString(goName)
+	return string(unicode.ToLower(r)) + goName[size:]
+}
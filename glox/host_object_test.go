@@ -0,0 +1,129 @@
+package glox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type hostAddress struct {
+	City string
+}
+
+type hostUser struct {
+	Name     string
+	Age      int
+	Nickname string `lox:"alias"`
+	Password string `lox:"-"`
+	Address  hostAddress
+	Friend   *hostUser
+	secret   string
+}
+
+func (u *hostUser) Greet(greeting string) string {
+	return greeting + ", " + u.Name
+}
+
+func (u *hostUser) Birthday() {
+	u.Age++
+}
+
+func (u *hostUser) Fail() error {
+	return errors.New("user said no")
+}
+
+func hostRuntime(t *testing.T, user *hostUser) *Runtime {
+	runtime := New()
+	if err := runtime.Define("user", user); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return runtime
+}
+
+func TestHostObjectFieldsAndMethods(t *testing.T) {
+	user := &hostUser{Name: "Ada", Age: 36, Nickname: "Countess", Address: hostAddress{"London"}}
+	user.Friend = &hostUser{Name: "Charles"}
+	runtime := hostRuntime(t, user)
+
+	testcases := map[string]Value{
+		"user.name;":                   StringValue("Ada"),
+		"user.age + 1;":                NumberValue(37),
+		"user.alias;":                  StringValue("Countess"),
+		"user.address.city;":           StringValue("London"),
+		"user.friend.name;":            StringValue("Charles"),
+		"user.friend.friend;":          Nil,
+		`user.greet("Hello");`:         StringValue("Hello, Ada"),
+		`var g = user.greet; g("Hi");`: StringValue("Hi, Ada"),
+	}
+	for source, expected := range testcases {
+		actual, err := runtime.Eval(context.Background(), source)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", source, err)
+		} else if actual != expected {
+			t.Errorf("%s: Expected: %v Actual: %v", source, expected, actual)
+		}
+	}
+}
+
+func TestHostObjectSharesStateWithHost(t *testing.T) {
+	user := &hostUser{Name: "Ada", Age: 36}
+	runtime := hostRuntime(t, user)
+
+	_, err := runtime.Eval(context.Background(), `
+	user.birthday();
+	user.name = "Lovelace";
+	user.address.city = "Marylebone";
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	if user.Age != 37 || user.Name != "Lovelace" || user.Address.City != "Marylebone" {
+		t.Errorf("Expected the script's changes on the Go struct, got %+v", user)
+	}
+
+	value, _ := runtime.Eval(context.Background(), "user;")
+	if value.Kind() != HostKind || value.Interface() != user {
+		t.Errorf("Expected the host to get its own pointer back, got %v", value.Interface())
+	}
+}
+
+func TestHostObjectErrors(t *testing.T) {
+	runtime := hostRuntime(t, &hostUser{Name: "Ada"})
+
+	testcases := map[string]string{
+		"user.secret;":      "Undefined property 'secret'.",
+		"user.password;":    "Undefined property 'password'.",
+		"user.missing = 1;": "hostUser has no field 'missing'",
+		`user.age = "old";`: "can't assign 'age': expected a number but got a string",
+		"user.age = 1.5;":   "can't assign 'age': expected a whole number",
+		"user.fail();":      "user said no",
+		"user.greet();":     "Expected 1 arguments but got 0.",
+	}
+	for source, expected := range testcases {
+		_, err := runtime.Eval(context.Background(), source)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: Expected error containing %q, got %v", source, expected, err)
+		}
+	}
+}
+
+func TestHostObjectsPassBackToGo(t *testing.T) {
+	user := &hostUser{Name: "Ada"}
+	runtime := hostRuntime(t, user)
+	runtime.DefineFunc("nameOf", func(u *hostUser) string { return u.Name })
+	runtime.DefineFunc("newUser", func(name string) *hostUser { return &hostUser{Name: name} })
+
+	value, err := runtime.Eval(context.Background(), `nameOf(user) + " & " + newUser("Charles").name;`)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if s, _ := value.AsString(); s != "Ada & Charles" {
+		t.Errorf("Expected: Ada & Charles Actual: %v", value)
+	}
+
+	if value, _ := runtime.Eval(context.Background(), "user;"); value.String() != "hostUser instance" {
+		t.Errorf("Expected: hostUser instance Actual: %v", value)
+	}
+}
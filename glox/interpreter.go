@@ -1,219 +1,592 @@
 package glox
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"reflect"
+	"io"
+	"os"
 )
 
-type interpreter struct{}
+type interpreter struct {
+	globals     *environment
+	environment *environment
+	// environments are the ones blocks and calls will go back to once the
+	// current one's done with, and stack the values the interpreter holds on
+	// to while it evaluates something else. With the globals they're the
+	// garbage collector's roots.
+	environments []*environment
+	stack        []Value
+	callStack    []callFrame
+	stdout       io.Writer
+	gc           collector
+	limits
+}
 
 func NewInterpreter() *interpreter {
-	return &interpreter{}
+	globals := NewEnvironment(nil)
+	globals.define("clock", functionValue(clockNative()))
+
+	i := &interpreter{
+		globals:     globals,
+		environment: globals,
+		stdout:      os.Stdout,
+		gc:          newCollector(),
+		limits:      newLimits(),
+	}
+	i.gc.track(globals)
+	return i
 }
 
-func (i *interpreter) Interpret(expr Expr) error {
-	value, err := i.evaluate(expr)
-	if err != nil {
-		return err
-	}
+func (i *interpreter) Interpret(statements []Stmt) error {
+	_, err := i.Evaluate(context.Background(), statements)
+	return err
+}
 
-	if value == nil {
-		value = "nil"
-	}
+// Evaluate runs statements in order and returns the value of the last one if
+// it's an expression statement, so a host can use Lox to compute a value.
+// Cancelling ctx stops it with ErrInterrupted at the next loop iteration,
+// call or top-level statement.
+func (i *interpreter) Evaluate(ctx context.Context, statements []Stmt) (Value, error) {
+	defer i.limitTo(ctx)()
+
+	var value Value
+	for _, statement := range statements {
+		if err := i.checkLimits(); err != nil {
+			return Nil, NodeRuntimeError(statement, err)
+		}
+		i.gc.collectIfNeeded(i)
+
+		value = Nil
+		if stmt, ok := statement.(*Expression); ok {
+			var err error
+			if value, err = i.evaluate(stmt.Expression); err != nil {
+				return Nil, err
+			}
+			continue
+		}
 
-	fmt.Printf("%v\n", value)
-	return nil
+		if err := i.execute(statement); err != nil {
+			return Nil, err
+		}
+	}
+	return value, nil
 }
 
-func (i *interpreter) visitLiteralExpr(literal *Literal) (interface{}, error) {
-	return literal.Value, nil
+func (i *interpreter) visitExpressionStmt(stmt *Expression) (interface{}, error) {
+	_, err := i.evaluate(stmt.Expression)
+	return nil, err
 }
 
-func (i *interpreter) visitGroupingExpr(expr *Grouping) (interface{}, error) {
-	return i.evaluate(expr.Expression)
-}
+func (i *interpreter) visitPrintStmt(stmt *Print) (interface{}, error) {
+	value, err := i.evaluate(stmt.Expression)
+	if err != nil {
+		return nil, err
+	}
 
-func (i *interpreter) visitUnaryExpr(expr *Unary) (interface{}, error) {
-	right, _ := i.evaluate(expr.Right)
+	fmt.Fprintln(i.stdout, value)
+	return nil, nil
+}
 
-	switch expr.Operator.tokenType {
-	case MINUS:
-		err := i.checkNumericOperand(expr.Operator, right)
-		if err != nil {
+func (i *interpreter) visitVarStmt(stmt *Var) (interface{}, error) {
+	var value Value
+	if stmt.Initializer != nil {
+		var err error
+		if value, err = i.evaluate(stmt.Initializer); err != nil {
 			return nil, err
 		}
-		value, _ := right.(float64)
-		return -value, nil
-	case BANG:
-		return !i.isTruthy(right), nil
 	}
 
+	i.environment.define(stmt.Name.lexeme, value)
 	return nil, nil
 }
 
-func (i *interpreter) visitBinaryExpr(expr *Binary) (interface{}, error) {
-	left, _ := i.evaluate(expr.Left)
-	right, _ := i.evaluate(expr.Right)
+func (i *interpreter) visitBlockStmt(stmt *Block) (interface{}, error) {
+	env := NewEnvironment(i.environment)
+	i.gc.track(env)
+	return nil, i.executeBlock(stmt.Statements, env)
+}
 
-	switch expr.Operator.tokenType {
-	case MINUS:
-		err := i.checkNumericOperands(expr.Operator, left, right)
-		if err != nil {
-			return nil, err
-		}
-		return left.(float64) - right.(float64), nil
-	case PLUS:
-		if i.isString(left) && i.isString(right) {
-			return left.(string) + right.(string), nil
-		} else if i.isNumeric(left) && i.isNumeric(right) {
-			return left.(float64) + right.(float64), nil
-		} else {
-			return nil, errors.New("operands in addition must both be numeric or both be strings")
+func (i *interpreter) visitIfStmt(stmt *If) (interface{}, error) {
+	condition, err := i.evaluate(stmt.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	if condition.Truthy() {
+		return nil, i.execute(stmt.ThenBranch)
+	} else if stmt.ElseBranch != nil {
+		return nil, i.execute(stmt.ElseBranch)
+	}
+	return nil, nil
+}
+
+func (i *interpreter) visitWhileStmt(stmt *While) (interface{}, error) {
+	for {
+		if err := i.checkLimits(); err != nil {
+			return nil, NodeRuntimeError(stmt.Condition, err)
 		}
-	case SLASH:
-		if err := i.checkNumericOperands(expr.Operator, left, right); err != nil {
+		i.gc.collectIfNeeded(i)
+
+		condition, err := i.evaluate(stmt.Condition)
+		if err != nil {
 			return nil, err
 		}
-		if err := i.checkDivideByZero(right.(float64)); err != nil {
-			return nil, err
+		if !condition.Truthy() {
+			return nil, nil
 		}
-		return left.(float64) / right.(float64), nil
-	case STAR:
-		err := i.checkNumericOperands(expr.Operator, left, right)
-		if err != nil {
+
+		if err := i.execute(stmt.Body); err != nil {
 			return nil, err
 		}
-		return left.(float64) * right.(float64), nil
-	case GREATER:
-		err := i.checkNumericOperands(expr.Operator, left, right)
+	}
+}
+
+func (i *interpreter) visitFunctionStmt(stmt *Function) (interface{}, error) {
+	function := NewLoxFunction(stmt, i.environment, false)
+	i.gc.track(function)
+	i.environment.define(stmt.Name.lexeme, functionValue(function))
+	return nil, nil
+}
+
+func (i *interpreter) visitClassStmt(stmt *Class) (interface{}, error) {
+	var superclass *loxClass
+	if stmt.Superclass != nil {
+		value, err := i.evaluate(stmt.Superclass)
 		if err != nil {
 			return nil, err
 		}
-		return left.(float64) > right.(float64), nil
-	case GREATER_EQUAL:
-		err := i.checkNumericOperands(expr.Operator, left, right)
-		if err != nil {
-			return nil, err
+
+		class, ok := value.object().(*loxClass)
+		if !ok {
+			return nil, TokenRuntimeError(stmt.Superclass.Name, errors.New("Superclass must be a class."))
 		}
-		return left.(float64) >= right.(float64), nil
-	case LESS:
-		err := i.checkNumericOperands(expr.Operator, left, right)
-		if err != nil {
+		superclass = class
+	}
+
+	i.environment.define(stmt.Name.lexeme, Nil)
+
+	if superclass != nil {
+		i.environment = NewEnvironment(i.environment)
+		i.environment.define("super", classValue(superclass))
+	}
+
+	methods := make(map[string]*loxFunction)
+	for _, method := range stmt.Methods {
+		methods[method.Name.lexeme] = NewLoxFunction(method, i.environment, method.Name.lexeme == "init")
+	}
+
+	class := NewLoxClass(stmt.Name.lexeme, superclass, methods)
+	i.gc.track(class)
+
+	if superclass != nil {
+		i.environment = i.environment.enclosing
+	}
+
+	return nil, i.environment.assign(stmt.Name, classValue(class))
+}
+
+func (i *interpreter) visitReturnStmt(stmt *Return) (interface{}, error) {
+	var value Value
+	if stmt.Value != nil {
+		var err error
+		if value, err = i.evaluate(stmt.Value); err != nil {
 			return nil, err
 		}
-		return left.(float64) < right.(float64), nil
-	case LESS_EQUAL:
-		err := i.checkNumericOperands(expr.Operator, left, right)
+	}
+
+	return nil, &returnValue{value}
+}
+
+func (i *interpreter) visitCallExpr(expr *Call) (Value, error) {
+	callee, err := i.evaluate(expr.Callee)
+	if err != nil {
+		return Nil, err
+	}
+
+	// The callee and arguments stay on the stack until the call's finished,
+	// and the arguments are passed as a slice of it.
+	base := len(i.stack)
+	defer func() { i.stack = i.stack[:base] }()
+
+	i.stack = append(i.stack, callee)
+	for _, argument := range expr.Arguments {
+		value, err := i.evaluate(argument)
 		if err != nil {
-			return nil, err
+			return Nil, err
 		}
-		return left.(float64) <= right.(float64), nil
-	case EQUAL_EQUAL:
-		return i.isEqual(left, right), nil
-	case BANG_EQUAL:
-		return !i.isEqual(left, right), nil
+		i.stack = append(i.stack, value)
 	}
+	arguments := i.stack[base+1 : len(i.stack) : len(i.stack)]
 
-	return nil, nil
+	function, ok := callee.object().(LoxCallable)
+	if !ok {
+		return Nil, TokenRuntimeError(expr.Paren, errors.New("Can only call functions and classes."))
+	}
+
+	if len(arguments) != function.arity() {
+		return Nil, TokenRuntimeError(
+			expr.Paren,
+			fmt.Errorf("Expected %d arguments but got %d.", function.arity(), len(arguments)),
+		)
+	}
+
+	return i.call(function, arguments, expr)
 }
 
-func (i *interpreter) visitTernaryExpr(expr *Ternary) (interface{}, error) {
-	left, _ := i.evaluate(expr.Left)
-	if i.isTruthy(left) {
-		return i.evaluate(expr.Middle)
-	} else {
-		return i.evaluate(expr.Right)
+// callContext is call for the host, limited by ctx as Evaluate is.
+func (i *interpreter) callContext(ctx context.Context, function LoxCallable, arguments []Value) (Value, error) {
+	defer i.limitTo(ctx)()
+
+	base := len(i.stack)
+	defer func() { i.stack = i.stack[:base] }()
+	i.stack = append(i.stack, arguments...)
+
+	return i.call(function, arguments, nil)
+}
+
+// call runs function with a frame for it on the call stack. The first time a
+// runtime error passes back through a call, it's given the stack trace from
+// where it happened. expr is nil when the call comes from the host program
+// rather than from Lox source.
+func (i *interpreter) call(function LoxCallable, arguments []Value, expr *Call) (Value, error) {
+	var callSite Position
+	if expr != nil {
+		callSite = expr.Span().Start
 	}
+	i.callStack = append(i.callStack, callFrame{callableName(function), callSite})
+	defer func() { i.callStack = i.callStack[:len(i.callStack)-1] }()
+
+	err := i.checkLimits()
+	if err == nil {
+		err = i.checkCallDepth(len(i.callStack))
+	}
+	if err == nil {
+		i.gc.collectIfNeeded(i)
+	}
+	var value Value
+	if err == nil {
+		value, err = function.call(i, arguments)
+	}
+	if err == nil {
+		return value, nil
+	}
+
+	rtErr, ok := err.(*runtimeError)
+	if !ok && expr != nil {
+		rtErr = TokenRuntimeError(expr.Paren, err)
+	} else if !ok {
+		rtErr = RuntimeError(callSite.Line, err)
+	}
+	if rtErr.trace == nil {
+		attachTrace(rtErr, i.stackTrace(rtErr.span.Start))
+	}
+	return Nil, rtErr
 }
 
-func (i *interpreter) evaluate(expr Expr) (interface{}, error) {
-	return expr.Accept(i)
+func (i *interpreter) visitGetExpr(expr *Get) (Value, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return Nil, err
+	}
+
+	switch object := object.object().(type) {
+	case *loxInstance:
+		value, err := object.get(expr.Name)
+		if err == nil {
+			i.gc.trackValue(value)
+		}
+		return value, err
+	case *hostObject:
+		return object.get(expr.Name)
+	}
+
+	return Nil, TokenRuntimeError(expr.Name, errors.New("Only instances have properties."))
 }
 
-func (i *interpreter) isTruthy(x interface{}) bool {
-	if x == nil {
-		return false
+func (i *interpreter) visitSetExpr(expr *Set) (Value, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return Nil, err
+	}
+
+	switch object.object().(type) {
+	case *loxInstance, *hostObject:
+	default:
+		return Nil, TokenRuntimeError(expr.Name, errors.New("Only instances have fields."))
 	}
 
-	if reflect.TypeOf(false) == reflect.TypeOf(x) || reflect.TypeOf(true) == reflect.TypeOf(x) {
-		return x.(bool)
+	i.stack = append(i.stack, object)
+	value, err := i.evaluate(expr.Value)
+	i.stack = i.stack[:len(i.stack)-1]
+	if err != nil {
+		return Nil, err
 	}
 
-	if reflect.ValueOf(x).Kind() == reflect.Bool {
-		return x.(bool)
+	switch object := object.object().(type) {
+	case *loxInstance:
+		if _, ok := object.fields[expr.Name.lexeme]; !ok {
+			if err := i.allocate(fieldSize); err != nil {
+				return Nil, TokenRuntimeError(expr.Name, err)
+			}
+		}
+		object.set(expr.Name, value)
+	case *hostObject:
+		if err := object.set(expr.Name, value); err != nil {
+			return Nil, err
+		}
+	}
+	return value, nil
+}
+
+// visitSuperExpr finds the superclass through the environment the class
+// declaration created, and "this" in the environment just inside it.
+func (i *interpreter) visitSuperExpr(expr *Super) (Value, error) {
+	distance, _ := expr.scopeDepth()
+	superclass := i.environment.getAt(distance, "super").object().(*loxClass)
+	object := i.environment.getAt(distance-1, "this").object().(*loxInstance)
+
+	method := superclass.findMethod(expr.Method.lexeme)
+	if method == nil {
+		return Nil, TokenRuntimeError(expr.Method, fmt.Errorf("Undefined property '%s'.", expr.Method.lexeme))
 	}
 
-	return true
+	bound := method.bind(object)
+	i.gc.track(bound)
+	return functionValue(bound), nil
+}
+
+func (i *interpreter) visitThisExpr(expr *This) (Value, error) {
+	return i.lookUpVariable(expr.Keyword, expr)
 }
 
-func (i *interpreter) isString(x interface{}) bool {
-	if x == nil {
-		return false
+func (i *interpreter) visitVariableExpr(expr *Variable) (Value, error) {
+	return i.lookUpVariable(expr.Name, expr)
+}
+
+func (i *interpreter) visitAssignExpr(expr *Assign) (Value, error) {
+	value, err := i.evaluate(expr.Value)
+	if err != nil {
+		return Nil, err
 	}
 
-	if reflect.TypeOf("") == reflect.TypeOf(x) {
-		return true
+	if distance, ok := expr.scopeDepth(); ok {
+		i.environment.assignAt(distance, expr.Name, value)
+	} else if err := i.globals.assign(expr.Name, value); err != nil {
+		return Nil, err
 	}
+	return value, nil
+}
+
+func (i *interpreter) visitLiteralExpr(literal *Literal) (Value, error) {
+	value, _ := valueOf(literal.Value)
+	return value, nil
+}
+
+func (i *interpreter) visitGroupingExpr(expr *Grouping) (Value, error) {
+	return i.evaluate(expr.Expression)
+}
 
-	if reflect.ValueOf(x).Kind() == reflect.String {
-		return true
+func (i *interpreter) visitUnaryExpr(expr *Unary) (Value, error) {
+	right, err := i.evaluate(expr.Right)
+	if err != nil {
+		return Nil, err
 	}
 
-	return false
+	switch expr.Operator.tokenType {
+	case MINUS:
+		if err := i.checkNumericOperand(expr.Operator, right); err != nil {
+			return Nil, err
+		}
+		return NumberValue(-right.number()), nil
+	case BANG:
+		return BoolValue(!right.Truthy()), nil
+	}
+
+	return Nil, nil
 }
 
-func (i *interpreter) isNumeric(x interface{}) bool {
-	if x == nil {
-		return false
+func (i *interpreter) visitBinaryExpr(expr *Binary) (Value, error) {
+	left, err := i.evaluate(expr.Left)
+	if err != nil {
+		return Nil, err
+	}
+	i.stack = append(i.stack, left)
+	right, err := i.evaluate(expr.Right)
+	i.stack = i.stack[:len(i.stack)-1]
+	if err != nil {
+		return Nil, err
+	}
+
+	switch expr.Operator.tokenType {
+	case PLUS:
+		if left.IsNumber() && right.IsNumber() {
+			return NumberValue(left.number() + right.number()), nil
+		} else if left.IsString() && right.IsString() {
+			if err := i.allocate(len(left.str()) + len(right.str())); err != nil {
+				return Nil, TokenRuntimeError(expr.Operator, err)
+			}
+			return StringValue(left.str() + right.str()), nil
+		}
+		return Nil, TokenRuntimeError(
+			expr.Operator,
+			errors.New("Operands must be two numbers or two strings."),
+		)
+	case EQUAL_EQUAL:
+		return BoolValue(left.Equal(right)), nil
+	case BANG_EQUAL:
+		return BoolValue(!left.Equal(right)), nil
 	}
 
-	if reflect.TypeOf(1.0) == reflect.TypeOf(x) {
-		return true
+	if err := i.checkNumericOperands(expr.Operator, left, right); err != nil {
+		return Nil, err
 	}
+	a, b := left.number(), right.number()
 
-	if reflect.ValueOf(x).Kind() == reflect.Float64 {
-		return true
+	switch expr.Operator.tokenType {
+	case MINUS:
+		return NumberValue(a - b), nil
+	case SLASH:
+		if err := i.checkDivideByZero(expr.Operator, b); err != nil {
+			return Nil, err
+		}
+		return NumberValue(a / b), nil
+	case STAR:
+		return NumberValue(a * b), nil
+	case GREATER:
+		return BoolValue(a > b), nil
+	case GREATER_EQUAL:
+		return BoolValue(a >= b), nil
+	case LESS:
+		return BoolValue(a < b), nil
+	case LESS_EQUAL:
+		return BoolValue(a <= b), nil
 	}
 
-	return false
+	return Nil, nil
+}
+
+func (i *interpreter) visitTernaryExpr(expr *Ternary) (Value, error) {
+	left, err := i.evaluate(expr.Left)
+	if err != nil {
+		return Nil, err
+	}
+	if left.Truthy() {
+		return i.evaluate(expr.Middle)
+	} else {
+		return i.evaluate(expr.Right)
+	}
 }
 
-func (i *interpreter) isEqual(x interface{}, y interface{}) bool {
-	if x == nil && y == nil {
-		return true
+// visitLogicalExpr short-circuits and returns the operand that decided the
+// result rather than coercing it to a boolean.
+func (i *interpreter) visitLogicalExpr(expr *Logical) (Value, error) {
+	left, err := i.evaluate(expr.Left)
+	if err != nil {
+		return Nil, err
 	}
-	if x == nil {
-		return false
+
+	if expr.Operator.tokenType == OR {
+		if left.Truthy() {
+			return left, nil
+		}
+	} else {
+		if !left.Truthy() {
+			return left, nil
+		}
 	}
-	if x == y {
-		return true
+
+	return i.evaluate(expr.Right)
+}
+
+// evaluate switches on the type of expression itself rather than going
+// through Accept, which would box every result in an interface{} and so
+// allocate for each number computed along the way.
+func (i *interpreter) evaluate(expr Expr) (Value, error) {
+	switch expr := expr.(type) {
+	case *Binary:
+		return i.visitBinaryExpr(expr)
+	case *Literal:
+		return i.visitLiteralExpr(expr)
+	case *Variable:
+		return i.visitVariableExpr(expr)
+	case *Assign:
+		return i.visitAssignExpr(expr)
+	case *Call:
+		return i.visitCallExpr(expr)
+	case *Logical:
+		return i.visitLogicalExpr(expr)
+	case *Unary:
+		return i.visitUnaryExpr(expr)
+	case *Grouping:
+		return i.visitGroupingExpr(expr)
+	case *Get:
+		return i.visitGetExpr(expr)
+	case *Set:
+		return i.visitSetExpr(expr)
+	case *This:
+		return i.visitThisExpr(expr)
+	case *Super:
+		return i.visitSuperExpr(expr)
+	case *Ternary:
+		return i.visitTernaryExpr(expr)
+	default:
+		return Nil, fmt.Errorf("can't evaluate %T", expr)
 	}
-	return reflect.DeepEqual(x, y)
 }
 
-func (i *interpreter) checkNumericOperand(operator *Token, x interface{}) error {
-	if _, ok := x.(float64); !ok {
-		return fmt.Errorf(
-			"operand '%v' in '%s' operation is not a numeric value",
-			x, operator.lexeme,
-		)
+func (i *interpreter) execute(stmt Stmt) error {
+	_, err := stmt.Accept(i)
+	return err
+}
+
+// resolve records how many environments away the variable referenced by expr
+// was declared. It's called by the resolver before the program runs.
+func (i *interpreter) resolve(expr localExpr, depth int) {
+	expr.resolveAt(depth)
+}
+
+func (i *interpreter) lookUpVariable(name *Token, expr localExpr) (Value, error) {
+	if distance, ok := expr.scopeDepth(); ok {
+		return i.environment.getAt(distance, name.lexeme), nil
 	}
-	return nil
+	return i.globals.get(name)
 }
 
-func (i *interpreter) checkNumericOperands(operator *Token, left, right interface{}) error {
-	for _, x := range []interface{}{left, right} {
-		if err := i.checkNumericOperand(operator, x); err != nil {
+func (i *interpreter) executeBlock(statements []Stmt, env *environment) error {
+	previous := i.environment
+	i.environments = append(i.environments, previous)
+	defer func() {
+		i.environment = previous
+		i.environments = i.environments[:len(i.environments)-1]
+	}()
+
+	i.environment = env
+	for _, statement := range statements {
+		if err := i.execute(statement); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (i *interpreter) checkDivideByZero(right float64) error {
+func (i *interpreter) checkNumericOperand(operator *Token, x Value) error {
+	if !x.IsNumber() {
+		return TokenRuntimeError(operator, errors.New("Operand must be a number."))
+	}
+	return nil
+}
+
+func (i *interpreter) checkNumericOperands(operator *Token, left, right Value) error {
+	if !left.IsNumber() || !right.IsNumber() {
+		return TokenRuntimeError(operator, errors.New("Operands must be numbers."))
+	}
+	return nil
+}
+
+func (i *interpreter) checkDivideByZero(operator *Token, right float64) error {
 	if right == 0 {
-		return fmt.Errorf("cannot divide by zero")
+		return TokenRuntimeError(operator, errors.New("cannot divide by zero"))
 	}
 	return nil
 }
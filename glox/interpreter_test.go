@@ -4,10 +4,10 @@ import "testing"
 
 func TestInterpreterEvaluatesWholeExpressions(t *testing.T) {
 	interpreter := NewInterpreter()
-	testcases := map[string]float64{
-		"(5 - (3 - 1)) + -1":      2.0,
-		"-(1 + 1)":                -2.0,
-		"1 == -(2 - 3) ? 1.0 : 0": 1.0,
+	testcases := map[string]Value{
+		"(5 - (3 - 1)) + -1":      NumberValue(2),
+		"-(1 + 1)":                NumberValue(-2),
+		"1 == -(2 - 3) ? 1.0 : 0": NumberValue(1),
 	}
 
 	for source, expected := range testcases {
@@ -31,7 +31,7 @@ func TestInterpreterEvaluatesTruthyBinary(t *testing.T) {
 	for _, source := range sources {
 		e := parsedExpression(source)
 		result, _ := interpreter.visitBinaryExpr(e.(*Binary))
-		if result != true {
+		if result != BoolValue(true) {
 			t.Errorf("Expression '%s' should evaluate to true", source)
 		}
 	}
@@ -39,11 +39,11 @@ func TestInterpreterEvaluatesTruthyBinary(t *testing.T) {
 
 func TestIntegerMath(t *testing.T) {
 	interpreter := NewInterpreter()
-	testcases := map[string]float64{
-		"3 + 3": 6.0,
-		"5 - 3": 2.0,
-		"6 / 2": 3.0,
-		"2 * 3": 6.0,
+	testcases := map[string]Value{
+		"3 + 3": NumberValue(6),
+		"5 - 3": NumberValue(2),
+		"6 / 2": NumberValue(3),
+		"2 * 3": NumberValue(6),
 	}
 
 	for source, expected := range testcases {
@@ -55,9 +55,9 @@ func TestIntegerMath(t *testing.T) {
 
 func TestUnaryExpressions(t *testing.T) {
 	interpreter := NewInterpreter()
-	testcases := map[string]interface{}{
-		"!true": false,
-		"-3":    -3.0,
+	testcases := map[string]Value{
+		"!true": BoolValue(false),
+		"-3":    NumberValue(-3),
 	}
 
 	for source, expected := range testcases {
@@ -69,11 +69,11 @@ func TestUnaryExpressions(t *testing.T) {
 
 func TestTernaryExpressions(t *testing.T) {
 	interpreter := NewInterpreter()
-	testcases := map[string]interface{}{
-		"2.0 > 1.0 ? 2.0 : 1.0":     2.0,
-		"1.0 > 2.0 ? 2.0 : 1.0":     1.0,
-		"1.0 == 1.0 ? true : false": true,
-		"1.0 == 2.0 ? true : false": false,
+	testcases := map[string]Value{
+		"2.0 > 1.0 ? 2.0 : 1.0":     NumberValue(2),
+		"1.0 > 2.0 ? 2.0 : 1.0":     NumberValue(1),
+		"1.0 == 1.0 ? true : false": BoolValue(true),
+		"1.0 == 2.0 ? true : false": BoolValue(false),
 	}
 
 	for source, expected := range testcases {
@@ -88,7 +88,7 @@ func TestGroupingExpressions(t *testing.T) {
 	source := "(3 - 1)"
 	e := parsedExpression(source)
 	result, _ := interpreter.visitGroupingExpr(e.(*Grouping))
-	assertEqualWithError(result, 2.0, t, source)
+	assertEqualWithError(result, NumberValue(2), t, source)
 }
 
 func TestLiteralExpression(t *testing.T) {
@@ -96,16 +96,128 @@ func TestLiteralExpression(t *testing.T) {
 	source := "2"
 	e := parsedExpression(source)
 	result, _ := interpreter.visitLiteralExpr(e.(*Literal))
-	assertEqualWithError(result, 2.0, t, source)
+	assertEqualWithError(result, NumberValue(2), t, source)
+}
+
+func TestInterpretStatements(t *testing.T) {
+	interpreter := NewInterpreter()
+	source := `1 + 2; print "one"; print 2 * 3;`
+	tokens, _ := NewScanner(source).ScanTokens()
+	statements, _ := NewParser(tokens).parse()
+
+	if err := interpreter.Interpret(statements); err != nil {
+		t.Errorf("Expected statements to run without error, got %v", err)
+	}
+}
+
+func TestInterpretBlocksAndVariables(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	var a = "global";
+	var b;
+	{
+		var a = "block";
+		b = a;
+	}
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	for name, expected := range map[string]Value{"a": StringValue("global"), "b": StringValue("block")} {
+		value, _ := interpreter.environment.get(NewToken(IDENTIFIER, name, nil, 0))
+		if value != expected {
+			t.Errorf("Variable '%s' incorrect.\n\nExpected: %v\nGot: %v", name, expected, value)
+		}
+	}
+}
+
+func TestInterpretUndefinedVariableInExpression(t *testing.T) {
+	_, err := interpretedSource("\nprint 1 + missing;")
+	if err == nil {
+		t.Fatalf("Expected an undefined variable error")
+	}
+
+	expected := "[Line 2] Error: Undefined variable 'missing'."
+	if err.Error() != expected {
+		t.Errorf("Expected: %s Actual: %s", expected, err.Error())
+	}
+}
+
+func TestLogicalExpressionsReturnDecidingOperand(t *testing.T) {
+	interpreter := NewInterpreter()
+	testcases := map[string]Value{
+		`nil or "yes"`:  StringValue("yes"),
+		`"first" or 2`:  StringValue("first"),
+		`false and 1`:   BoolValue(false),
+		`1 and "right"`: StringValue("right"),
+		`nil and 1`:     Nil,
+	}
+
+	for source, expected := range testcases {
+		e := parsedExpression(source)
+		result, _ := interpreter.visitLogicalExpr(e.(*Logical))
+		assertEqualWithError(result, expected, t, source)
+	}
+}
+
+func TestLogicalExpressionsShortCircuit(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	var called = false;
+	true or (called = true);
+	false and (called = true);
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	value, _ := interpreter.environment.get(NewToken(IDENTIFIER, "called", nil, 0))
+	if value != BoolValue(false) {
+		t.Errorf("Expected right operands to be skipped, but they were evaluated")
+	}
+}
+
+func TestControlFlowStatements(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	var sum = 0;
+	for (var i = 0; i < 5; i = i + 1) {
+		if (i == 2) sum = sum + 100; else sum = sum + i;
+	}
+	var countdown = 3;
+	while (countdown > 0) countdown = countdown - 1;
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	for name, expected := range map[string]Value{"sum": NumberValue(108), "countdown": NumberValue(0)} {
+		value, _ := interpreter.environment.get(NewToken(IDENTIFIER, name, nil, 0))
+		if value != expected {
+			t.Errorf("Variable '%s' incorrect.\n\nExpected: %v\nGot: %v", name, expected, value)
+		}
+	}
+}
+
+func interpretedSource(source string) (*interpreter, error) {
+	interpreter := NewInterpreter()
+	tokens, _ := NewScanner(source).ScanTokens()
+	statements, errs := NewParser(tokens).parse()
+	if len(errs) > 0 {
+		return interpreter, errs[0]
+	}
+	if errs := NewResolver(interpreter).Resolve(statements); len(errs) > 0 {
+		return interpreter, errs[0]
+	}
+	return interpreter, interpreter.Interpret(statements)
 }
 
 func parsedExpression(source string) Expr {
 	tokens, _ := NewScanner(source).ScanTokens()
 	parser := NewParser(tokens)
-	return parser.parse()
+	expr, _ := parser.expression()
+	return expr
 }
 
-func assertEqualWithError(result interface{}, expected interface{}, t *testing.T, source string) {
+func assertEqualWithError(result Value, expected Value, t *testing.T, source string) {
 	if result != expected {
 		t.Errorf(
 			"Expression '%s' evaluated incorrectly.\n\nExpected: %v\nGot: %v",
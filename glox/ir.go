@@ -0,0 +1,518 @@
+package glox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// irOp is what an irInstruction does.
+type irOp int
+
+const (
+	irConst irOp = iota
+	irMove
+	irGetVar
+	irSetVar
+	irGetGlobal
+	irDefineGlobal
+	irSetGlobal
+	irUnary
+	irBinary
+	irCall
+	irGetProperty
+	irSetProperty
+	irGetSuper
+	irClosure
+	irClass
+	irInherit
+	irMethod
+	irPrint
+	irReturn
+	irJump
+	irJumpIfFalse
+	irLabel
+)
+
+// irInstruction is one step of a function lowered to the linear IR. It reads
+// the temporaries in args and, if it has a result, writes it to dest. Unlike
+// the vm's bytecode nothing is left on a stack, so every value an instruction
+// uses is named.
+type irInstruction struct {
+	op       irOp
+	dest     int
+	args     []int
+	name     string      // the variable, property, class or operator
+	constant interface{} // irConst's literal
+	function *irFunction // irClosure's
+	label    int         // the label, or where a jump goes
+	line     int
+}
+
+func (in irInstruction) String() string {
+	args := make([]string, len(in.args))
+	for idx, arg := range in.args {
+		args[idx] = irTemp(arg)
+	}
+	dest := irTemp(in.dest)
+
+	switch in.op {
+	case irConst:
+		if s, ok := in.constant.(string); ok {
+			return fmt.Sprintf("%s = %q", dest, s)
+		}
+		value, _ := valueOf(in.constant)
+		return fmt.Sprintf("%s = %s", dest, value)
+	case irMove:
+		return fmt.Sprintf("%s = %s", dest, args[0])
+	case irGetVar:
+		return fmt.Sprintf("%s = %s", dest, in.name)
+	case irSetVar:
+		return fmt.Sprintf("%s = %s", in.name, args[0])
+	case irGetGlobal:
+		return fmt.Sprintf("%s = @%s", dest, in.name)
+	case irDefineGlobal:
+		return fmt.Sprintf("define @%s = %s", in.name, args[0])
+	case irSetGlobal:
+		return fmt.Sprintf("@%s = %s", in.name, args[0])
+	case irUnary:
+		return fmt.Sprintf("%s = %s%s", dest, in.name, args[0])
+	case irBinary:
+		return fmt.Sprintf("%s = %s %s %s", dest, args[0], in.name, args[1])
+	case irCall:
+		return fmt.Sprintf("%s = call %s(%s)", dest, args[0], strings.Join(args[1:], ", "))
+	case irGetProperty:
+		return fmt.Sprintf("%s = %s.%s", dest, args[0], in.name)
+	case irSetProperty:
+		return fmt.Sprintf("%s.%s = %s", args[0], in.name, args[1])
+	case irGetSuper:
+		return fmt.Sprintf("%s = super.%s", dest, in.name)
+	case irClosure:
+		return fmt.Sprintf("%s = closure %s", dest, in.function.name)
+	case irClass:
+		return fmt.Sprintf("%s = class %s", dest, in.name)
+	case irInherit:
+		return fmt.Sprintf("inherit %s, %s", args[0], args[1])
+	case irMethod:
+		return fmt.Sprintf("method %s.%s = %s", args[0], in.name, args[1])
+	case irPrint:
+		return fmt.Sprintf("print %s", args[0])
+	case irReturn:
+		return fmt.Sprintf("return %s", args[0])
+	case irJump:
+		return fmt.Sprintf("jump L%d", in.label)
+	case irJumpIfFalse:
+		return fmt.Sprintf("jump_if_false %s, L%d", args[0], in.label)
+	case irLabel:
+		return fmt.Sprintf("L%d:", in.label)
+	}
+	return fmt.Sprintf("unknown op %d", in.op)
+}
+
+func irTemp(temp int) string {
+	return fmt.Sprintf("t%d", temp)
+}
+
+// irFunction is a function, or the script, lowered to the IR. Temporaries and
+// labels are numbered from zero in each function.
+type irFunction struct {
+	name      string
+	params    []string
+	code      []irInstruction
+	temps     int
+	labels    int
+	functions []*irFunction
+}
+
+func (f *irFunction) String() string {
+	if f.name == "" {
+		return scriptFrameName
+	}
+	return fmt.Sprintf("<fn %s(%s)>", f.name, strings.Join(f.params, ", "))
+}
+
+// irNames hands out names that are unique across a program, so a variable
+// that shadows another, or two functions called the same, can be told apart
+// in the IR. The second x is x.1, the third x.2, and so on.
+type irNames map[string]int
+
+func (n irNames) unique(name string) string {
+	count := n[name]
+	n[name]++
+	if count == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s.%d", name, count)
+}
+
+// irLowerer lowers the AST for one function into the IR. Each function nested
+// in it gets a lowerer of its own that starts from the scopes it's declared
+// in, so the variables it captures keep their names. Globals aren't in any
+// scope; they're looked up by name when the code runs, as the engines do.
+type irLowerer struct {
+	function    *irFunction
+	scopes      []map[string]string
+	variables   irNames
+	functions   irNames
+	initializer bool
+	line        int
+}
+
+// lowerIR lowers statements as the top level of a script. When the last of
+// them is an expression statement, the script returns its value, as it does
+// in both engines. The statements must have been resolved without errors.
+func lowerIR(statements []Stmt) *irFunction {
+	l := &irLowerer{function: &irFunction{}, variables: irNames{}, functions: irNames{}}
+	for idx, statement := range statements {
+		if stmt, ok := statement.(*Expression); ok && idx == len(statements)-1 {
+			value := l.expression(stmt.Expression)
+			l.emit(irInstruction{op: irReturn, args: []int{value}})
+			return l.function
+		}
+		l.statement(statement)
+		l.line = statement.Span().End.Line
+	}
+
+	l.emitReturn()
+	return l.function
+}
+
+func (l *irLowerer) visitExpressionStmt(stmt *Expression) (interface{}, error) {
+	l.expression(stmt.Expression)
+	return nil, nil
+}
+
+func (l *irLowerer) visitPrintStmt(stmt *Print) (interface{}, error) {
+	value := l.expression(stmt.Expression)
+	l.emit(irInstruction{op: irPrint, args: []int{value}})
+	return nil, nil
+}
+
+func (l *irLowerer) visitVarStmt(stmt *Var) (interface{}, error) {
+	var value int
+	if stmt.Initializer != nil {
+		value = l.expression(stmt.Initializer)
+	} else {
+		value = l.constant(nil)
+	}
+	l.defineVariable(l.declareVariable(stmt.Name.lexeme), value)
+	return nil, nil
+}
+
+func (l *irLowerer) visitBlockStmt(stmt *Block) (interface{}, error) {
+	l.beginScope()
+	for _, statement := range stmt.Statements {
+		l.statement(statement)
+	}
+	l.endScope()
+	return nil, nil
+}
+
+func (l *irLowerer) visitIfStmt(stmt *If) (interface{}, error) {
+	elseLabel := l.newLabel()
+	condition := l.expression(stmt.Condition)
+	l.emit(irInstruction{op: irJumpIfFalse, args: []int{condition}, label: elseLabel})
+	l.statement(stmt.ThenBranch)
+
+	if stmt.ElseBranch == nil {
+		l.placeLabel(elseLabel)
+		return nil, nil
+	}
+	endLabel := l.newLabel()
+	l.emit(irInstruction{op: irJump, label: endLabel})
+	l.placeLabel(elseLabel)
+	l.statement(stmt.ElseBranch)
+	l.placeLabel(endLabel)
+	return nil, nil
+}
+
+func (l *irLowerer) visitWhileStmt(stmt *While) (interface{}, error) {
+	startLabel, exitLabel := l.newLabel(), l.newLabel()
+	l.placeLabel(startLabel)
+	condition := l.expression(stmt.Condition)
+	l.emit(irInstruction{op: irJumpIfFalse, args: []int{condition}, label: exitLabel})
+	l.statement(stmt.Body)
+	l.emit(irInstruction{op: irJump, label: startLabel})
+	l.placeLabel(exitLabel)
+	return nil, nil
+}
+
+// visitFunctionStmt declares a local function before lowering its body, so
+// the body can call it by the name it's given here.
+func (l *irLowerer) visitFunctionStmt(stmt *Function) (interface{}, error) {
+	name := l.declareVariable(stmt.Name.lexeme)
+	closure := l.newTemp()
+	l.emit(irInstruction{op: irClosure, dest: closure, function: l.lowerFunction(stmt, name, false)})
+	l.defineVariable(name, closure)
+	return nil, nil
+}
+
+func (l *irLowerer) visitReturnStmt(stmt *Return) (interface{}, error) {
+	if stmt.Value == nil {
+		l.emitReturn()
+		return nil, nil
+	}
+	value := l.expression(stmt.Value)
+	l.emit(irInstruction{op: irReturn, args: []int{value}})
+	return nil, nil
+}
+
+func (l *irLowerer) visitClassStmt(stmt *Class) (interface{}, error) {
+	name := l.declareVariable(stmt.Name.lexeme)
+	class := l.newTemp()
+	l.emit(irInstruction{op: irClass, dest: class, name: stmt.Name.lexeme})
+	l.defineVariable(name, class)
+
+	if stmt.Superclass != nil {
+		superclass := l.expression(stmt.Superclass)
+		l.emit(irInstruction{op: irInherit, args: []int{class, superclass}})
+	}
+
+	for _, method := range stmt.Methods {
+		function := l.lowerFunction(method, name+"."+method.Name.lexeme, method.Name.lexeme == "init")
+		closure := l.newTemp()
+		l.emit(irInstruction{op: irClosure, dest: closure, function: function})
+		l.emit(irInstruction{op: irMethod, args: []int{class, closure}, name: method.Name.lexeme})
+	}
+	return nil, nil
+}
+
+func (l *irLowerer) visitLiteralExpr(expr *Literal) (interface{}, error) {
+	return l.constant(expr.Value), nil
+}
+
+func (l *irLowerer) visitGroupingExpr(expr *Grouping) (interface{}, error) {
+	return l.expression(expr.Expression), nil
+}
+
+func (l *irLowerer) visitUnaryExpr(expr *Unary) (interface{}, error) {
+	right := l.expression(expr.Right)
+	dest := l.newTemp()
+	l.emit(irInstruction{op: irUnary, dest: dest, args: []int{right}, name: expr.Operator.lexeme})
+	return dest, nil
+}
+
+func (l *irLowerer) visitBinaryExpr(expr *Binary) (interface{}, error) {
+	left := l.expression(expr.Left)
+	right := l.expression(expr.Right)
+	dest := l.newTemp()
+	l.emit(irInstruction{op: irBinary, dest: dest, args: []int{left, right}, name: expr.Operator.lexeme})
+	return dest, nil
+}
+
+func (l *irLowerer) visitTernaryExpr(expr *Ternary) (interface{}, error) {
+	dest, elseLabel, endLabel := l.newTemp(), l.newLabel(), l.newLabel()
+	condition := l.expression(expr.Left)
+	l.emit(irInstruction{op: irJumpIfFalse, args: []int{condition}, label: elseLabel})
+	l.move(dest, l.expression(expr.Middle))
+	l.emit(irInstruction{op: irJump, label: endLabel})
+	l.placeLabel(elseLabel)
+	l.move(dest, l.expression(expr.Right))
+	l.placeLabel(endLabel)
+	return dest, nil
+}
+
+// visitLogicalExpr gives the result a temporary of its own, which holds the
+// left operand when that decides the answer and the right one otherwise.
+func (l *irLowerer) visitLogicalExpr(expr *Logical) (interface{}, error) {
+	dest, endLabel := l.newTemp(), l.newLabel()
+	left := l.expression(expr.Left)
+	l.move(dest, left)
+
+	if expr.Operator.tokenType == OR {
+		elseLabel := l.newLabel()
+		l.emit(irInstruction{op: irJumpIfFalse, args: []int{left}, label: elseLabel})
+		l.emit(irInstruction{op: irJump, label: endLabel})
+		l.placeLabel(elseLabel)
+	} else {
+		l.emit(irInstruction{op: irJumpIfFalse, args: []int{left}, label: endLabel})
+	}
+	l.move(dest, l.expression(expr.Right))
+	l.placeLabel(endLabel)
+	return dest, nil
+}
+
+func (l *irLowerer) visitVariableExpr(expr *Variable) (interface{}, error) {
+	return l.load(expr.Name.lexeme), nil
+}
+
+func (l *irLowerer) visitAssignExpr(expr *Assign) (interface{}, error) {
+	value := l.expression(expr.Value)
+	if name, ok := l.lookup(expr.Name.lexeme); ok {
+		l.emit(irInstruction{op: irSetVar, args: []int{value}, name: name})
+	} else {
+		l.emit(irInstruction{op: irSetGlobal, args: []int{value}, name: expr.Name.lexeme})
+	}
+	return value, nil
+}
+
+func (l *irLowerer) visitCallExpr(expr *Call) (interface{}, error) {
+	args := []int{l.expression(expr.Callee)}
+	for _, argument := range expr.Arguments {
+		args = append(args, l.expression(argument))
+	}
+	dest := l.newTemp()
+	l.emit(irInstruction{op: irCall, dest: dest, args: args})
+	return dest, nil
+}
+
+func (l *irLowerer) visitGetExpr(expr *Get) (interface{}, error) {
+	object := l.expression(expr.Object)
+	dest := l.newTemp()
+	l.emit(irInstruction{op: irGetProperty, dest: dest, args: []int{object}, name: expr.Name.lexeme})
+	return dest, nil
+}
+
+func (l *irLowerer) visitSetExpr(expr *Set) (interface{}, error) {
+	object := l.expression(expr.Object)
+	value := l.expression(expr.Value)
+	l.emit(irInstruction{op: irSetProperty, args: []int{object, value}, name: expr.Name.lexeme})
+	return value, nil
+}
+
+// visitThisExpr reads this as a variable. It's always the receiver of the
+// method it's written in, so it doesn't need a unique name.
+func (l *irLowerer) visitThisExpr(expr *This) (interface{}, error) {
+	dest := l.newTemp()
+	l.emit(irInstruction{op: irGetVar, dest: dest, name: "this"})
+	return dest, nil
+}
+
+func (l *irLowerer) visitSuperExpr(expr *Super) (interface{}, error) {
+	dest := l.newTemp()
+	l.emit(irInstruction{op: irGetSuper, dest: dest, name: expr.Method.lexeme})
+	return dest, nil
+}
+
+// statement and expression lower a node with the line it starts on, which is
+// then recorded against everything emitted for it.
+func (l *irLowerer) statement(stmt Stmt) {
+	defer l.atLine(stmt.Span().Start.Line)()
+	stmt.Accept(l)
+}
+
+// expression returns the temporary that holds the value of expr.
+func (l *irLowerer) expression(expr Expr) int {
+	defer l.atLine(expr.Span().Start.Line)()
+	value, _ := expr.Accept(l)
+	return value.(int)
+}
+
+func (l *irLowerer) atLine(line int) func() {
+	previous := l.line
+	l.line = line
+	return func() { l.line = previous }
+}
+
+// lowerFunction lowers declaration with a lowerer of its own and returns it,
+// listed among the functions this one defines. Its parameters and body share
+// a scope, as they do in the resolver.
+func (l *irLowerer) lowerFunction(declaration *Function, name string, initializer bool) *irFunction {
+	fl := &irLowerer{
+		function:    &irFunction{name: l.functions.unique(name)},
+		scopes:      append(append([]map[string]string{}, l.scopes...), map[string]string{}),
+		variables:   l.variables,
+		functions:   l.functions,
+		initializer: initializer,
+		line:        declaration.Span().Start.Line,
+	}
+	for _, param := range declaration.Params {
+		fl.function.params = append(fl.function.params, fl.declareVariable(param.lexeme))
+	}
+	for _, statement := range declaration.Body {
+		fl.statement(statement)
+	}
+	fl.line = declaration.Span().End.Line
+	fl.emitReturn()
+
+	l.function.functions = append(l.function.functions, fl.function)
+	return fl.function
+}
+
+// emitReturn returns nil, or this from an initializer.
+func (l *irLowerer) emitReturn() {
+	var value int
+	if l.initializer {
+		value = l.newTemp()
+		l.emit(irInstruction{op: irGetVar, dest: value, name: "this"})
+	} else {
+		value = l.constant(nil)
+	}
+	l.emit(irInstruction{op: irReturn, args: []int{value}})
+}
+
+func (l *irLowerer) constant(value interface{}) int {
+	dest := l.newTemp()
+	l.emit(irInstruction{op: irConst, dest: dest, constant: value})
+	return dest
+}
+
+func (l *irLowerer) move(dest, src int) {
+	l.emit(irInstruction{op: irMove, dest: dest, args: []int{src}})
+}
+
+func (l *irLowerer) load(name string) int {
+	dest := l.newTemp()
+	if local, ok := l.lookup(name); ok {
+		l.emit(irInstruction{op: irGetVar, dest: dest, name: local})
+	} else {
+		l.emit(irInstruction{op: irGetGlobal, dest: dest, name: name})
+	}
+	return dest
+}
+
+// declareVariable returns the name a new variable goes by in the IR: its own
+// at the top level, where it's a global, otherwise a unique one in the
+// innermost scope.
+func (l *irLowerer) declareVariable(name string) string {
+	if len(l.scopes) == 0 {
+		return name
+	}
+	local := l.variables.unique(name)
+	l.scopes[len(l.scopes)-1][name] = local
+	return local
+}
+
+// defineVariable gives the variable declareVariable named its first value.
+func (l *irLowerer) defineVariable(name string, value int) {
+	if len(l.scopes) == 0 {
+		l.emit(irInstruction{op: irDefineGlobal, args: []int{value}, name: name})
+	} else {
+		l.emit(irInstruction{op: irSetVar, args: []int{value}, name: name})
+	}
+}
+
+func (l *irLowerer) lookup(name string) (string, bool) {
+	for i := len(l.scopes) - 1; i >= 0; i-- {
+		if local, ok := l.scopes[i][name]; ok {
+			return local, true
+		}
+	}
+	return "", false
+}
+
+func (l *irLowerer) beginScope() {
+	l.scopes = append(l.scopes, map[string]string{})
+}
+
+func (l *irLowerer) endScope() {
+	l.scopes = l.scopes[:len(l.scopes)-1]
+}
+
+func (l *irLowerer) newTemp() int {
+	l.function.temps++
+	return l.function.temps - 1
+}
+
+func (l *irLowerer) newLabel() int {
+	l.function.labels++
+	return l.function.labels - 1
+}
+
+func (l *irLowerer) placeLabel(label int) {
+	l.emit(irInstruction{op: irLabel, label: label})
+}
+
+func (l *irLowerer) emit(instruction irInstruction) {
+	instruction.line = l.line
+	l.function.code = append(l.function.code, instruction)
+}
@@ -0,0 +1,97 @@
+package glox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func lowerSource(t *testing.T, source string) *irFunction {
+	statements, err := New().compile(source, NewInterpreter())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return lowerIR(statements)
+}
+
+func TestLowerIR(t *testing.T) {
+	source := "var a = 1;\nwhile (a < 3) a = a + 1;\nif (a or nil) print a; else print \"no\";"
+
+	var out bytes.Buffer
+	NewDisassembler(&out, source).ir(lowerSource(t, source))
+
+	expected := `== <script> ==
+   1 | var a = 1;
+     t0 = 1
+     define @a = t0
+   2 | while (a < 3) a = a + 1;
+L0:
+     t1 = @a
+     t2 = 3
+     t3 = t1 < t2
+     jump_if_false t3, L1
+     t4 = @a
+     t5 = 1
+     t6 = t4 + t5
+     @a = t6
+     jump L0
+L1:
+   3 | if (a or nil) print a; else print "no";
+     t8 = @a
+     t7 = t8
+     jump_if_false t8, L4
+     jump L3
+L4:
+     t9 = nil
+     t7 = t9
+L3:
+     jump_if_false t7, L2
+     t10 = @a
+     print t10
+     jump L5
+L2:
+     t11 = "no"
+     print t11
+L5:
+     t12 = nil
+     return t12
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nActual:\n%s", expected, out.String())
+	}
+}
+
+func TestLowerIRFunctions(t *testing.T) {
+	source := `
+fun outer(x) {
+  { var x = 2; fun inner() { return x; } return inner; }
+}
+class A < B { init() { this.m = super.m; } }`
+
+	var out bytes.Buffer
+	NewDisassembler(&out, source).ir(lowerSource(t, source))
+
+	for _, expected := range []string{
+		"== <fn outer(x)> ==",
+		"     x.1 = t0\n",
+		"     inner = t1\n",
+		"== <fn inner()> ==\n   3 | { var x = 2; fun inner() { return x; } return inner; }\n     t0 = x.1\n     return t0\n",
+		"     inherit t1, t2\n",
+		"     method t1.init = t3\n",
+		"== <fn A.init()> ==",
+		"     t1 = super.m\n     t0.m = t1\n     t2 = this\n     return t2\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestLowerIRReturnsLastExpression(t *testing.T) {
+	script := lowerSource(t, "1 + 2;")
+
+	last := script.code[len(script.code)-1]
+	if last.String() != "return t2" {
+		t.Errorf("Expected the script to return the sum, got %v", last)
+	}
+}
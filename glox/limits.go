@@ -0,0 +1,117 @@
+package glox
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrInterrupted is the error a script stops with when the context it's
+	// running under is cancelled or times out.
+	ErrInterrupted = errors.New("interrupted")
+
+	// ErrBudgetExceeded is the error a script stops with when it's taken more
+	// steps than the runtime allows.
+	ErrBudgetExceeded = errors.New("step budget exceeded")
+
+	// ErrStackOverflow is the error a script stops with when its calls nest
+	// deeper than the runtime allows.
+	ErrStackOverflow = errors.New("Stack overflow.")
+
+	// ErrAllocationLimit is the error a script stops with when it's allocated
+	// more memory than the runtime allows.
+	ErrAllocationLimit = errors.New("allocation budget exceeded")
+)
+
+const (
+	// defaultMaxCallDepth keeps runaway recursion well clear of the Go stack
+	// limit, each Lox call being a good few Go calls deep.
+	defaultMaxCallDepth = 10000
+
+	// Rough sizes charged against the allocation budget for things other than
+	// strings, which are charged their length.
+	instanceSize = 64
+	fieldSize    = 32
+)
+
+// limits is what a script is allowed to do, and how much of it it's done so
+// far. Both engines embed it.
+type limits struct {
+	ctx       context.Context
+	steps     int
+	maxSteps  int
+	allocated int
+	maxAlloc  int
+	maxDepth  int
+	granted   map[Capability]bool
+}
+
+func newLimits() limits {
+	return limits{
+		ctx:      context.Background(),
+		maxDepth: defaultMaxCallDepth,
+		granted:  make(map[Capability]bool),
+	}
+}
+
+// checkLimits counts a step and says whether the script should stop. It's
+// called for each top-level statement, loop iteration and function call, the
+// only places a script can keep itself running indefinitely.
+func (l *limits) checkLimits() error {
+	select {
+	case <-l.ctx.Done():
+		return ErrInterrupted
+	default:
+	}
+
+	l.steps++
+	if l.maxSteps > 0 && l.steps > l.maxSteps {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+// checkCallDepth stops a call that would take the stack past depth frames.
+func (l *limits) checkCallDepth(depth int) error {
+	if depth >= l.maxDepth {
+		return ErrStackOverflow
+	}
+	return nil
+}
+
+// allocate charges size bytes against the allocation budget. The budget
+// counts everything allocated, not what's still live, so it bounds how much
+// work the garbage collector can be given as well as how much memory is held.
+func (l *limits) allocate(size int) error {
+	l.allocated += size
+	if l.maxAlloc > 0 && l.allocated > l.maxAlloc {
+		return ErrAllocationLimit
+	}
+	return nil
+}
+
+// limitTo starts counting steps and allocations afresh under ctx, and returns
+// a function that puts back the limits of whatever was running before.
+func (l *limits) limitTo(ctx context.Context) func() {
+	previousCtx, previousSteps, previousAllocated := l.ctx, l.steps, l.allocated
+	l.ctx, l.steps, l.allocated = ctx, 0, 0
+	return func() {
+		l.ctx, l.steps, l.allocated = previousCtx, previousSteps, previousAllocated
+	}
+}
+
+// clone copies the limits for another runtime, which starts with nothing
+// counted against them.
+func (l *limits) clone() limits {
+	granted := make(map[Capability]bool, len(l.granted))
+	for capability, ok := range l.granted {
+		granted[capability] = ok
+	}
+	return limits{
+		ctx:      l.ctx,
+		maxSteps: l.maxSteps,
+		maxAlloc: l.maxAlloc,
+		maxDepth: l.maxDepth,
+		granted:  granted,
+	}
+}
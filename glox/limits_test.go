@@ -0,0 +1,115 @@
+package glox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfiniteLoopTimesOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := New().Eval(ctx, "while (true) {}")
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Expected ErrInterrupted, got %v", err)
+	}
+
+	rtErr, ok := err.(*runtimeError)
+	if !ok || rtErr.span.String() != "0:7-0:11" {
+		t.Errorf("Expected the error to point at the loop condition, got %v", err)
+	}
+}
+
+func TestStepLimit(t *testing.T) {
+	testcases := map[string]string{
+		"loop":      "var i = 0; while (i < 100) i = i + 1;",
+		"for loop":  "for (var i = 0; i < 100; i = i + 1) {}",
+		"recursion": "fun f(n) { if (n > 0) f(n - 1); } f(100);",
+	}
+
+	for name, source := range testcases {
+		if _, err := New(WithStepLimit(50)).Eval(context.Background(), source); !errors.Is(err, ErrBudgetExceeded) {
+			t.Errorf("%s: Expected ErrBudgetExceeded, got %v", name, err)
+		}
+		if _, err := New(WithStepLimit(500)).Eval(context.Background(), source); err != nil {
+			t.Errorf("%s: Expected to finish within budget, got %v", name, err)
+		}
+	}
+}
+
+func TestStepLimitIsPerEvaluation(t *testing.T) {
+	runtime := New(WithStepLimit(50))
+	for n := 0; n < 3; n++ {
+		if _, err := runtime.Eval(context.Background(), "for (var i = 0; i < 40; i = i + 1) {}"); err != nil {
+			t.Fatalf("Run %d: expected each Eval to get a fresh budget, got %v", n, err)
+		}
+	}
+}
+
+func TestCallContextInterrupted(t *testing.T) {
+	runtime := New()
+	if _, err := runtime.Eval(context.Background(), "fun spin() { while (true) {} }"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := runtime.CallContext(ctx, "spin")
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Expected ErrInterrupted, got %v", err)
+	}
+	if d := DiagnosticFor(err); len(d.Trace) != 2 || d.Trace[0].Function != "spin" {
+		t.Errorf("Expected a trace through spin, got %v", d.Trace)
+	}
+
+	if _, err := runtime.Eval(context.Background(), "1;"); err != nil {
+		t.Errorf("Expected the runtime to be usable after an interruption, got %v", err)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	source := "fun f(n) { return f(n + 1); } f(0);"
+
+	for _, runtime := range []*Runtime{New(), New(WithMaxCallDepth(100))} {
+		_, err := runtime.Eval(context.Background(), source)
+		if !errors.Is(err, ErrStackOverflow) || !strings.Contains(err.Error(), "Error: Stack overflow.") {
+			t.Fatalf("Expected a stack overflow, got %v", err)
+		}
+
+		d := DiagnosticFor(err)
+		if len(d.Trace) != maxTraceFrames || !strings.HasSuffix(d.Note, "more frames not shown") {
+			t.Errorf("Expected the trace to be cut short, got %d frames and note %q", len(d.Trace), d.Note)
+		}
+	}
+
+	if _, err := New(WithMaxCallDepth(100)).Eval(context.Background(), "fun f(n) { if (n > 0) f(n - 1); } f(90);"); err != nil {
+		t.Errorf("Expected recursion within the limit to work, got %v", err)
+	}
+}
+
+func TestAllocationLimit(t *testing.T) {
+	testcases := map[string]string{
+		"strings":   `var s = "x"; while (true) s = s + s;`,
+		"instances": `class Box {} var b; while (true) b = Box();`,
+		"fields": `class Box {} var b = Box();
+		while (true) { b.next = Box(); b = b.next; }`,
+	}
+
+	for name, source := range testcases {
+		_, err := New(WithAllocationLimit(1<<16)).Eval(context.Background(), source)
+		if !errors.Is(err, ErrAllocationLimit) {
+			t.Errorf("%s: Expected ErrAllocationLimit, got %v", name, err)
+		}
+	}
+
+	runtime := New(WithAllocationLimit(64))
+	for n := 0; n < 3; n++ {
+		if _, err := runtime.Eval(context.Background(), `"abc" + "def";`); err != nil {
+			t.Fatalf("Run %d: expected each Eval to get a fresh budget, got %v", n, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package glox
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// NativeFunc is a Go function callable from Lox. It's only ever given as many
+// arguments as the arity it was defined with, in a slice of its own that it
+// may keep.
+type NativeFunc func(args []Value) (Value, error)
+
+// DefineNative makes fn a global function called name. Scripts may only call
+// it if the runtime has been granted all of capabilities.
+func (r *Runtime) DefineNative(name string, arity int, fn NativeFunc, capabilities ...Capability) {
+	r.define(name, functionValue(&nativeFunction{
+		name:         name,
+		arityValue:   arity,
+		capabilities: capabilities,
+		fn:           fn,
+	}))
+}
+
+// Define makes value, converted as ValueOf does, a global called name. It's
+// how a host hands a script a pointer to one of its own structs.
+func (r *Runtime) Define(name string, value interface{}) error {
+	v, err := ValueOf(value)
+	if err != nil {
+		return fmt.Errorf("can't define '%s': %w", name, err)
+	}
+	r.define(name, v)
+	return nil
+}
+
+// DefineFunc makes any Go function a global function called name, converting
+// its arguments from Lox and its result back. The function may return
+// nothing, a value, an error, or a value and an error; errors become Lox
+// runtime errors, as do panics. Scripts may only call it if the runtime has
+// been granted all of capabilities.
+//
+// Lox numbers convert to any Go integer type as long as they're whole and
+// fit, and instances convert to a map[string]interface{} of their fields.
+// Parameters of type Value or interface{} take whatever they're given.
+func (r *Runtime) DefineFunc(name string, fn interface{}, capabilities ...Capability) error {
+	native, err := reflectNative(name, reflect.ValueOf(fn))
+	if err != nil {
+		return fmt.Errorf("can't define '%s': %w", name, err)
+	}
+	native.capabilities = capabilities
+	r.define(name, functionValue(native))
+	return nil
+}
+
+// reflectNative wraps the Go function fv so Lox can call it, converting
+// arguments and results as DefineFunc describes.
+func reflectNative(name string, fv reflect.Value) (*nativeFunction, error) {
+	if fv.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%s isn't a function", fv.Kind())
+	}
+	ft := fv.Type()
+	if ft.IsVariadic() {
+		return nil, errors.New("variadic functions aren't supported")
+	}
+	if ft.NumOut() > 2 || (ft.NumOut() == 2 && ft.Out(1) != errorType) {
+		return nil, errors.New("functions may only return a value, an error, or both")
+	}
+
+	return &nativeFunction{
+		name:       name,
+		arityValue: ft.NumIn(),
+		fn: func(arguments []Value) (result Value, err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("%s panicked: %v", name, p)
+				}
+			}()
+
+			in := make([]reflect.Value, 0, len(arguments))
+			for idx, argument := range arguments {
+				arg, err := fromLox(argument, ft.In(idx))
+				if err != nil {
+					return Nil, fmt.Errorf("argument %d to %s: %w", idx+1, name, err)
+				}
+				in = append(in, arg)
+			}
+
+			return resultToLox(fv.Call(in))
+		},
+	}, nil
+}
+
+var (
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+	valueType     = reflect.TypeOf(Value{})
+	fieldsMapType = reflect.TypeOf(map[string]interface{}{})
+)
+
+// resultToLox turns what a function bound by DefineFunc returned into a Lox
+// value and an error.
+func resultToLox(out []reflect.Value) (Value, error) {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return Nil, err
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return Nil, nil
+	}
+	return ValueOf(out[0].Interface())
+}
+
+// fromLox converts a Lox value to the Go type t.
+func fromLox(x Value, t reflect.Type) (reflect.Value, error) {
+	if t == valueType {
+		return reflect.ValueOf(x), nil
+	}
+	if x.IsNil() {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("expected %s but got nil", t)
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := wholeNumber(x)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v := reflect.New(t).Elem()
+		if n < math.MinInt64 || n >= math.MaxInt64 || v.OverflowInt(int64(n)) {
+			return reflect.Value{}, fmt.Errorf("%v doesn't fit in %s", n, t)
+		}
+		v.SetInt(int64(n))
+		return v, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := wholeNumber(x)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v := reflect.New(t).Elem()
+		if n < 0 || n >= math.MaxUint64 || v.OverflowUint(uint64(n)) {
+			return reflect.Value{}, fmt.Errorf("%v doesn't fit in %s", n, t)
+		}
+		v.SetUint(uint64(n))
+		return v, nil
+	case reflect.Float32, reflect.Float64:
+		if !x.IsNumber() {
+			return reflect.Value{}, fmt.Errorf("expected a number but got a %s", x.Kind())
+		}
+		return reflect.ValueOf(x.number()).Convert(t), nil
+	case reflect.Bool, reflect.String:
+		if v := reflect.ValueOf(x.Interface()); v.Kind() == t.Kind() {
+			return v.Convert(t), nil
+		}
+	}
+
+	if t == fieldsMapType {
+		var instanceFields map[string]Value
+		switch instance := x.object().(type) {
+		case *loxInstance:
+			instanceFields = instance.fields
+		case *vmInstance:
+			instanceFields = instance.fields
+		}
+		if instanceFields != nil {
+			fields := make(map[string]interface{}, len(instanceFields))
+			for name, value := range instanceFields {
+				fields[name] = value.Interface()
+			}
+			return reflect.ValueOf(fields), nil
+		}
+	}
+
+	if v := reflect.ValueOf(x.Interface()); v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	return reflect.Value{}, fmt.Errorf("expected %s but got a %s", t, x.Kind())
+}
+
+func wholeNumber(x Value) (float64, error) {
+	if !x.IsNumber() {
+		return 0, fmt.Errorf("expected a number but got a %s", x.Kind())
+	}
+	n := x.number()
+	if n != math.Trunc(n) {
+		return 0, errors.New("expected a whole number")
+	}
+	return n, nil
+}
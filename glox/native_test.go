@@ -0,0 +1,126 @@
+package glox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDefineNative(t *testing.T) {
+	runtime := New()
+	runtime.DefineNative("twice", 1, func(args []Value) (Value, error) {
+		n, err := args[0].AsNumber()
+		if err != nil {
+			return Nil, err
+		}
+		return NumberValue(n * 2), nil
+	})
+
+	value, err := runtime.Eval(context.Background(), "twice(21);")
+	if n, _ := value.AsNumber(); err != nil || n != 42 {
+		t.Errorf("Expected twice(21) to be 42, got %v, %v", value, err)
+	}
+
+	_, err = runtime.Eval(context.Background(), `twice("no");`)
+	if err == nil || !strings.Contains(err.Error(), "value is a string, not a number") {
+		t.Errorf("Expected the native's error to become a runtime error, got %v", err)
+	}
+
+	if _, err := runtime.Eval(context.Background(), "twice();"); err == nil {
+		t.Errorf("Expected arity to be checked")
+	}
+}
+
+func TestNativesMayKeepArguments(t *testing.T) {
+	for _, engine := range []Engine{EngineTree, EngineVM} {
+		var saved []Value
+		runtime := New(WithEngine(engine))
+		runtime.DefineNative("save", 1, func(args []Value) (Value, error) {
+			if saved == nil {
+				saved = args
+			}
+			return Nil, nil
+		})
+
+		if _, err := runtime.Eval(context.Background(), `save("first"); save("second");`); err != nil {
+			t.Fatalf("Engine %d: unexpected error %v", engine, err)
+		}
+		if s, _ := saved[0].AsString(); s != "first" {
+			t.Errorf("Engine %d: expected the saved argument to stay first, got %v", engine, saved[0])
+		}
+	}
+}
+
+type celsius float64
+
+func TestDefineFunc(t *testing.T) {
+	runtime := New()
+	funcs := map[string]interface{}{
+		"repeat":  strings.Repeat,
+		"half":    func(n int) (int, error) { return n / 2, nil },
+		"warm":    func(c celsius) bool { return c > 20 },
+		"fail":    func() error { return errors.New("failed") },
+		"explode": func() { panic("boom") },
+		"keys": func(fields map[string]interface{}) int {
+			return len(fields)
+		},
+		"identity": func(x interface{}) interface{} { return x },
+	}
+	for name, fn := range funcs {
+		if err := runtime.DefineFunc(name, fn); err != nil {
+			t.Fatalf("Unexpected error defining %s: %v", name, err)
+		}
+	}
+	if _, err := runtime.Eval(context.Background(), `
+	class Point { init(x, y) { this.x = x; this.y = y; } }
+	`); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	testcases := map[string]Value{
+		`repeat("ab", 3);`:         StringValue("ababab"),
+		"half(9);":                 NumberValue(4),
+		"warm(25);":                BoolValue(true),
+		"keys(Point(1, 2));":       NumberValue(2),
+		`identity("x") + "y";`:     StringValue("xy"),
+		"identity(nil) == nil;":    BoolValue(true),
+		"identity(Point)(0, 0).x;": NumberValue(0),
+	}
+	for source, expected := range testcases {
+		actual, err := runtime.Eval(context.Background(), source)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", source, err)
+		} else if actual != expected {
+			t.Errorf("%s: Expected: %v Actual: %v", source, expected, actual)
+		}
+	}
+
+	errorcases := map[string]string{
+		"half(1.5);":                   "argument 1 to half: expected a whole number",
+		`half("1");`:                   "argument 1 to half: expected a number but got a string",
+		"half(100000000000000000000);": "argument 1 to half: 1e+20 doesn't fit in int",
+		"fail();":                      "failed",
+		"explode();":                   "explode panicked: boom",
+	}
+	for source, expected := range errorcases {
+		_, err := runtime.Eval(context.Background(), source)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: Expected error containing %q, got %v", source, expected, err)
+		}
+	}
+}
+
+func TestDefineFuncRejectsUnsupportedFunctions(t *testing.T) {
+	runtime := New()
+	for name, fn := range map[string]interface{}{
+		"notAFunction":     1,
+		"variadic":         func(xs ...int) {},
+		"tooMany":          func() (int, int, error) { return 0, 0, nil },
+		"secondIsNotError": func() (int, int) { return 0, 0 },
+	} {
+		if err := runtime.DefineFunc(name, fn); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package glox
 
 import (
 	"errors"
+	"fmt"
 )
 
+const maxArguments = 255
+
 type parser struct {
 	tokens  []*Token
 	current int
+	errors  []error
 }
 
 func NewParser(tokens []*Token) *parser {
@@ -16,120 +20,639 @@ func NewParser(tokens []*Token) *parser {
 	}
 }
 
-func (p *parser) parse() Expr {
-	return p.expression()
+// parse returns every statement it could make sense of along with every
+// parseError it hit on the way, so a single pass reports all of them.
+func (p *parser) parse() ([]Stmt, []error) {
+	statements := make([]Stmt, 0)
+	for !p.isAtEnd() {
+		if stmt := p.declaration(); stmt != nil {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements, p.errors
+}
+
+// declaration records a failed declaration and skips to the next statement
+// boundary, returning nil so the caller can carry on parsing.
+func (p *parser) declaration() Stmt {
+	stmt, err := p.tryDeclaration()
+	if err != nil {
+		p.errors = append(p.errors, err)
+		p.synchronise()
+		return nil
+	}
+	return stmt
+}
+
+func (p *parser) tryDeclaration() (Stmt, error) {
+	start := p.peek()
+
+	var stmt Stmt
+	var err error
+	if p.match(CLASS) {
+		stmt, err = p.classDeclaration()
+	} else if p.match(FUN) {
+		stmt, err = p.function("function")
+	} else if p.match(VAR) {
+		stmt, err = p.varDeclaration()
+	} else {
+		return p.statement()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	p.mark(stmt, start)
+	return stmt, nil
+}
+
+func (p *parser) classDeclaration() (Stmt, error) {
+	name, err := p.consume(IDENTIFIER, "Expect class name.")
+	if err != nil {
+		return nil, err
+	}
+
+	var superclass *Variable
+	if p.match(LESS) {
+		superName, err := p.consume(IDENTIFIER, "Expect superclass name.")
+		if err != nil {
+			return nil, err
+		}
+		superclass = NewVariable(superName).(*Variable)
+		superclass.setSpan(superName.Span())
+	}
+
+	if _, err := p.consume(LEFT_BRACE, "Expect '{' before class body."); err != nil {
+		return nil, err
+	}
+
+	methods := make([]*Function, 0)
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		start := p.peek()
+		method, err := p.function("method")
+		if err != nil {
+			return nil, err
+		}
+		p.mark(method, start)
+		methods = append(methods, method.(*Function))
+	}
+
+	if _, err := p.consume(RIGHT_BRACE, "Expect '}' after class body."); err != nil {
+		return nil, err
+	}
+	return NewClass(name, superclass, methods), nil
+}
+
+func (p *parser) function(kind string) (Stmt, error) {
+	name, err := p.consume(IDENTIFIER, "Expect "+kind+" name.")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(LEFT_PAREN, "Expect '(' after "+kind+" name."); err != nil {
+		return nil, err
+	}
+
+	parameters := make([]*Token, 0)
+	if !p.check(RIGHT_PAREN) {
+		for {
+			if len(parameters) >= maxArguments {
+				p.error(p.peek(), fmt.Sprintf("Can't have more than %d parameters.", maxArguments))
+			}
+
+			param, err := p.consume(IDENTIFIER, "Expect parameter name.")
+			if err != nil {
+				return nil, err
+			}
+			parameters = append(parameters, param)
+
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+	if _, err := p.consume(RIGHT_PAREN, "Expect ')' after parameters."); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.consume(LEFT_BRACE, "Expect '{' before "+kind+" body."); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return NewFunction(name, parameters, body), nil
+}
+
+func (p *parser) varDeclaration() (Stmt, error) {
+	name, err := p.consume(IDENTIFIER, "Expect variable name.")
+	if err != nil {
+		return nil, err
+	}
+
+	var initializer Expr
+	if p.match(EQUAL) {
+		if initializer, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.consume(SEMICOLON, "Expect ';' after variable declaration."); err != nil {
+		return nil, err
+	}
+	return NewVar(name, initializer), nil
+}
+
+func (p *parser) statement() (Stmt, error) {
+	start := p.peek()
+
+	var stmt Stmt
+	var err error
+	if p.match(FOR) {
+		stmt, err = p.forStatement()
+	} else if p.match(IF) {
+		stmt, err = p.ifStatement()
+	} else if p.match(PRINT) {
+		stmt, err = p.printStatement()
+	} else if p.match(RETURN) {
+		stmt, err = p.returnStatement()
+	} else if p.match(WHILE) {
+		stmt, err = p.whileStatement()
+	} else if p.match(LEFT_BRACE) {
+		var statements []Stmt
+		if statements, err = p.block(); err == nil {
+			stmt = NewBlock(statements)
+		}
+	} else {
+		stmt, err = p.expressionStatement()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	p.mark(stmt, start)
+	return stmt, nil
+}
+
+// forStatement desugars a for loop into the equivalent while loop wrapped in
+// blocks for the initializer and increment. The nodes it makes up span the
+// whole loop.
+func (p *parser) forStatement() (Stmt, error) {
+	keyword := p.previous()
+	if _, err := p.consume(LEFT_PAREN, "Expect '(' after 'for'."); err != nil {
+		return nil, err
+	}
+
+	var initializer Stmt
+	var err error
+	initializerStart := p.peek()
+	if p.match(SEMICOLON) {
+		initializer = nil
+	} else if p.match(VAR) {
+		initializer, err = p.varDeclaration()
+	} else {
+		initializer, err = p.expressionStatement()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if initializer != nil {
+		p.mark(initializer, initializerStart)
+	}
+
+	var condition Expr
+	if !p.check(SEMICOLON) {
+		if condition, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.consume(SEMICOLON, "Expect ';' after loop condition."); err != nil {
+		return nil, err
+	}
+
+	var increment Expr
+	if !p.check(RIGHT_PAREN) {
+		if increment, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.consume(RIGHT_PAREN, "Expect ')' after for clauses."); err != nil {
+		return nil, err
+	}
+
+	body, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+
+	if increment != nil {
+		incrementStmt := NewExpression(increment)
+		incrementStmt.setSpan(increment.Span())
+		body = NewBlock([]Stmt{body, incrementStmt})
+		p.mark(body, keyword)
+	}
+	if condition == nil {
+		condition = NewLiteral(true)
+		p.mark(condition, keyword)
+	}
+	body = NewWhile(condition, body)
+	p.mark(body, keyword)
+	if initializer != nil {
+		body = NewBlock([]Stmt{initializer, body})
+		p.mark(body, keyword)
+	}
+
+	return body, nil
+}
+
+func (p *parser) ifStatement() (Stmt, error) {
+	if _, err := p.consume(LEFT_PAREN, "Expect '(' after 'if'."); err != nil {
+		return nil, err
+	}
+	condition, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(RIGHT_PAREN, "Expect ')' after if condition."); err != nil {
+		return nil, err
+	}
+
+	thenBranch, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	var elseBranch Stmt
+	if p.match(ELSE) {
+		if elseBranch, err = p.statement(); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewIf(condition, thenBranch, elseBranch), nil
+}
+
+func (p *parser) whileStatement() (Stmt, error) {
+	if _, err := p.consume(LEFT_PAREN, "Expect '(' after 'while'."); err != nil {
+		return nil, err
+	}
+	condition, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(RIGHT_PAREN, "Expect ')' after condition."); err != nil {
+		return nil, err
+	}
+
+	body, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	return NewWhile(condition, body), nil
 }
 
-func (p *parser) expression() Expr {
-	return p.ternary()
+func (p *parser) printStatement() (Stmt, error) {
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(SEMICOLON, "Expect ';' after value."); err != nil {
+		return nil, err
+	}
+	return NewPrint(value), nil
 }
 
-func (p *parser) ternary() Expr {
-	var expr Expr
-	expr = p.equality()
+func (p *parser) returnStatement() (Stmt, error) {
+	keyword := p.previous()
+	var value Expr
+	if !p.check(SEMICOLON) {
+		var err error
+		if value, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.consume(SEMICOLON, "Expect ';' after return value."); err != nil {
+		return nil, err
+	}
+	return NewReturn(keyword, value), nil
+}
+
+func (p *parser) expressionStatement() (Stmt, error) {
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(SEMICOLON, "Expect ';' after expression."); err != nil {
+		return nil, err
+	}
+	return NewExpression(expr), nil
+}
+
+// block recovers from errors in the declarations it contains, so the only
+// error it returns is a missing closing brace.
+func (p *parser) block() ([]Stmt, error) {
+	statements := make([]Stmt, 0)
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		if stmt := p.declaration(); stmt != nil {
+			statements = append(statements, stmt)
+		}
+	}
+
+	if _, err := p.consume(RIGHT_BRACE, "Expect '}' after block."); err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+func (p *parser) expression() (Expr, error) {
+	return p.assignment()
+}
+
+func (p *parser) assignment() (Expr, error) {
+	start := p.peek()
+	expr, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.match(EQUAL) {
+		equals := p.previous()
+		value, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+
+		if variable, ok := expr.(*Variable); ok {
+			return p.markExpr(NewAssign(variable.Name, value), start), nil
+		}
+		if get, ok := expr.(*Get); ok {
+			return p.markExpr(NewSet(get.Object, get.Name, value), start), nil
+		}
+
+		// The parser isn't confused about where it is, so there's no need
+		// to synchronise; just note the error and keep going.
+		p.error(equals, "Invalid assignment target.")
+	}
+
+	return expr, nil
+}
+
+func (p *parser) ternary() (Expr, error) {
+	start := p.peek()
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
 
 	if p.match(QUESTION) {
 		leftOperator := p.previous() // grab the QUESTION since that's the left operator.
-		middle := p.expression()
-		rightOperator, err := p.consume(COLON, "Expect ':' after expression")
+		middle, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		rightOperator, err := p.consume(COLON, "Expect ':' after expression.")
+		if err != nil {
+			return nil, err
+		}
+		right, err := p.expression()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		right := p.expression()
-		expr = NewTernary(expr, leftOperator, middle, rightOperator, right)
+		expr = p.markExpr(NewTernary(expr, leftOperator, middle, rightOperator, right), start)
 	}
-	return expr
+	return expr, nil
+}
+
+func (p *parser) or() (Expr, error) {
+	start := p.peek()
+	expr, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.match(OR) {
+		operator := p.previous()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		expr = p.markExpr(NewLogical(expr, operator, right), start)
+	}
+
+	return expr, nil
+}
+
+func (p *parser) and() (Expr, error) {
+	start := p.peek()
+	expr, err := p.equality()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.match(AND) {
+		operator := p.previous()
+		right, err := p.equality()
+		if err != nil {
+			return nil, err
+		}
+		expr = p.markExpr(NewLogical(expr, operator, right), start)
+	}
+
+	return expr, nil
 }
 
-func (p *parser) equality() Expr {
-	var expr Expr
-	expr = p.comparison()
+func (p *parser) equality() (Expr, error) {
+	start := p.peek()
+	expr, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
 
 	for p.match(BANG_EQUAL, EQUAL_EQUAL) {
 		operator := p.previous()
-		right := p.comparison()
-		expr = NewBinary(expr, operator, right)
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		expr = p.markExpr(NewBinary(expr, operator, right), start)
 	}
 
-	return expr
+	return expr, nil
 }
 
-func (p *parser) comparison() Expr {
-	var expr Expr
-	expr = p.term()
+func (p *parser) comparison() (Expr, error) {
+	start := p.peek()
+	expr, err := p.term()
+	if err != nil {
+		return nil, err
+	}
 
 	for p.match(GREATER, GREATER_EQUAL, LESS, LESS_EQUAL) {
 		operator := p.previous()
-		right := p.term()
-		expr = NewBinary(expr, operator, right)
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		expr = p.markExpr(NewBinary(expr, operator, right), start)
 	}
 
-	return expr
+	return expr, nil
 }
 
-func (p *parser) term() Expr {
-	var expr Expr
-	expr = p.factor()
+func (p *parser) term() (Expr, error) {
+	start := p.peek()
+	expr, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
 
 	for p.match(MINUS, PLUS) {
 		operator := p.previous()
-		right := p.factor()
-		expr = NewBinary(expr, operator, right)
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		expr = p.markExpr(NewBinary(expr, operator, right), start)
 	}
 
-	return expr
+	return expr, nil
 }
 
-func (p *parser) factor() Expr {
-	var expr Expr
-	expr = p.unary()
+func (p *parser) factor() (Expr, error) {
+	start := p.peek()
+	expr, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
 
 	for p.match(SLASH, STAR) {
 		operator := p.previous()
-		right := p.factor()
-		expr = NewBinary(expr, operator, right)
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		expr = p.markExpr(NewBinary(expr, operator, right), start)
 	}
 
-	return expr
+	return expr, nil
 }
 
-func (p *parser) unary() Expr {
+func (p *parser) unary() (Expr, error) {
 	if p.match(BANG, MINUS) {
 		operator := p.previous()
-		right := p.unary()
-		return NewUnary(operator, right)
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return p.markExpr(NewUnary(operator, right), operator), nil
+	}
+
+	return p.call()
+}
+
+func (p *parser) call() (Expr, error) {
+	start := p.peek()
+	expr, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if p.match(LEFT_PAREN) {
+			if expr, err = p.finishCall(expr); err != nil {
+				return nil, err
+			}
+			p.mark(expr, start)
+		} else if p.match(DOT) {
+			name, err := p.consume(IDENTIFIER, "Expect property name after '.'.")
+			if err != nil {
+				return nil, err
+			}
+			expr = p.markExpr(NewGet(expr, name), start)
+		} else {
+			break
+		}
+	}
+
+	return expr, nil
+}
+
+func (p *parser) finishCall(callee Expr) (Expr, error) {
+	arguments := make([]Expr, 0)
+	if !p.check(RIGHT_PAREN) {
+		for {
+			if len(arguments) >= maxArguments {
+				p.error(p.peek(), fmt.Sprintf("Can't have more than %d arguments.", maxArguments))
+			}
+			argument, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			arguments = append(arguments, argument)
+
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+
+	paren, err := p.consume(RIGHT_PAREN, "Expect ')' after arguments.")
+	if err != nil {
+		return nil, err
 	}
 
-	return p.primary()
+	return NewCall(callee, paren, arguments), nil
 }
 
-func (p *parser) primary() Expr {
-	var err error = nil
+func (p *parser) primary() (Expr, error) {
+	start := p.peek()
+
 	if p.match(FALSE) {
-		return NewLiteral(false)
+		return p.markExpr(NewLiteral(false), start), nil
 	}
 	if p.match(TRUE) {
-		return NewLiteral(true)
+		return p.markExpr(NewLiteral(true), start), nil
 	}
 	if p.match(NIL) {
-		return NewLiteral(nil)
+		return p.markExpr(NewLiteral(nil), start), nil
 	}
 
 	if p.match(NUMBER, STRING) {
-		return NewLiteral(p.previous().literal)
+		return p.markExpr(NewLiteral(p.previous().literal), start), nil
+	}
+
+	if p.match(SUPER) {
+		keyword := p.previous()
+		if _, err := p.consume(DOT, "Expect '.' after 'super'."); err != nil {
+			return nil, err
+		}
+		method, err := p.consume(IDENTIFIER, "Expect superclass method name.")
+		if err != nil {
+			return nil, err
+		}
+		return p.markExpr(NewSuper(keyword, method), start), nil
+	}
+
+	if p.match(THIS) {
+		return p.markExpr(NewThis(p.previous()), start), nil
+	}
+
+	if p.match(IDENTIFIER) {
+		return p.markExpr(NewVariable(p.previous()), start), nil
 	}
 
 	if p.match(LEFT_PAREN) {
-		expr := p.expression()
-		_, err = p.consume(RIGHT_PAREN, "Expect ')' after expression")
+		expr, err := p.expression()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		return NewGrouping(expr)
+		if _, err := p.consume(RIGHT_PAREN, "Expect ')' after expression."); err != nil {
+			return nil, err
+		}
+		return p.markExpr(NewGrouping(expr), start), nil
 	}
 
-	pe := ParseError(p.peek(), errors.New("expect expression"))
-	panic(pe)
+	return nil, ParseError(p.peek(), errors.New("Expect expression."))
 }
 
 func (p *parser) isAtEnd() bool {
@@ -182,28 +705,38 @@ func (p *parser) consume(tokenType TokenType, msg string) (*Token, error) {
 	return nil, ParseError(p.peek(), errors.New(msg))
 }
 
-// Apparently we'll need this for later
-//
-// func (p *parser) synchronise() {
-// 	p.advance()
-
-// 	for !p.isAtEnd() {
-// 		if p.previous().tokenType == SEMICOLON {
-// 			return
-// 		}
-
-// 		switch p.peek().tokenType {
-// 		case CLASS:
-// 		case FUN:
-// 		case VAR:
-// 		case FOR:
-// 		case IF:
-// 		case WHILE:
-// 		case PRINT:
-// 		case RETURN:
-// 			return
-// 		}
-
-// 		p.advance()
-// 	}
-// }
+// mark records that node was built from the tokens running from start up to
+// the most recently consumed one.
+func (p *parser) mark(node Node, start *Token) {
+	node.setSpan(Span{start.Span().Start, p.previous().Span().End})
+}
+
+func (p *parser) markExpr(expr Expr, start *Token) Expr {
+	p.mark(expr, start)
+	return expr
+}
+
+// error records a parseError without unwinding, for mistakes the parser can
+// carry on past without losing track of where it is.
+func (p *parser) error(token *Token, msg string) {
+	p.errors = append(p.errors, ParseError(token, errors.New(msg)))
+}
+
+// synchronise discards tokens until it reaches what's probably the start of
+// the next statement, so one mistake doesn't cascade into many.
+func (p *parser) synchronise() {
+	p.advance()
+
+	for !p.isAtEnd() {
+		if p.previous().tokenType == SEMICOLON {
+			return
+		}
+
+		switch p.peek().tokenType {
+		case CLASS, FUN, VAR, FOR, IF, WHILE, PRINT, RETURN:
+			return
+		}
+
+		p.advance()
+	}
+}
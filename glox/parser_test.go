@@ -4,7 +4,7 @@ import "testing"
 
 func TestParserParsesCorrectlySimple(t *testing.T) {
 	parser := simpleTestParser("1 + 1", t)
-	expression := parser.parse()
+	expression, _ := parser.expression()
 	expected := "(+ 1.0 1.0)"
 	actual, _ := NewAstPrinter().print(expression)
 	if actual != expected {
@@ -17,7 +17,7 @@ func TestParserParsesCorrectlySimple(t *testing.T) {
 
 func TestParserParsesCorrectlyAcceptanceTestExample(t *testing.T) {
 	parser := simpleTestParser("(5 - (3 - 1)) + -1", t)
-	expression := parser.parse()
+	expression, _ := parser.expression()
 	expected := "(+ (group (- 5.0 (group (- 3.0 1.0)))) (- 1.0))"
 	actual, _ := NewAstPrinter().print(expression)
 	if actual != expected {
@@ -30,8 +30,8 @@ func TestParserParsesCorrectlyAcceptanceTestExample(t *testing.T) {
 
 func TestParserParsesCorrectlyBetterExample(t *testing.T) {
 	parser := simpleTestParser("6 + 3 * 2 / 3 - 1 + -1 + (3 + 3)", t)
-	expression := parser.parse()
-	expected := "(+ (+ (- (+ 6.0 (* 3.0 (/ 2.0 3.0))) 1.0) (- 1.0)) (group (+ 3.0 3.0)))"
+	expression, _ := parser.expression()
+	expected := "(+ (+ (- (+ 6.0 (/ (* 3.0 2.0) 3.0)) 1.0) (- 1.0)) (group (+ 3.0 3.0)))"
 	actual, _ := NewAstPrinter().print(expression)
 	if actual != expected {
 		t.Errorf(
@@ -43,7 +43,7 @@ func TestParserParsesCorrectlyBetterExample(t *testing.T) {
 
 func TestParserParsesCorrectlyGreaterLess(t *testing.T) {
 	parser := simpleTestParser("6 < 3 <= 3 >= 1 > 0", t)
-	expression := parser.parse()
+	expression, _ := parser.expression()
 	expected := "(> (>= (<= (< 6.0 3.0) 3.0) 1.0) 0.0)"
 	actual, _ := NewAstPrinter().print(expression)
 	if actual != expected {
@@ -56,7 +56,7 @@ func TestParserParsesCorrectlyGreaterLess(t *testing.T) {
 
 func TestParserParsesCorrectlyBangEqualNilTrueFalse(t *testing.T) {
 	parser := simpleTestParser(`1 != 2 == true == false == nil != "hello"`, t)
-	expression := parser.parse()
+	expression, _ := parser.expression()
 	expected := "(!= (== (== (== (!= 1.0 2.0) true) false) nil) hello)"
 	actual, _ := NewAstPrinter().print(expression)
 	if actual != expected {
@@ -69,7 +69,7 @@ func TestParserParsesCorrectlyBangEqualNilTrueFalse(t *testing.T) {
 
 func TestParserTernaryOperator(t *testing.T) {
 	parser := simpleTestParser(`1 > 2 ? 1 : 2`, t)
-	expression := parser.parse()
+	expression, _ := parser.expression()
 	expected := `(?: (> 1.0 2.0) 1.0 2.0)`
 	actual, _ := NewAstPrinter().print(expression)
 	if actual != expected {
@@ -82,7 +82,7 @@ func TestParserTernaryOperator(t *testing.T) {
 
 func TestParserTernaryOperatorNested(t *testing.T) {
 	parser := simpleTestParser(`1 == 2 ? 3 ? 4 : 5 : 6 ? 7 : 8`, t)
-	expression := parser.parse()
+	expression, _ := parser.expression()
 	expected := `(?: (== 1.0 2.0) (?: 3.0 4.0 5.0) (?: 6.0 7.0 8.0))`
 	actual, _ := NewAstPrinter().print(expression)
 	if actual != expected {
@@ -93,6 +93,137 @@ func TestParserTernaryOperatorNested(t *testing.T) {
 	}
 }
 
+func TestParserParsesStatements(t *testing.T) {
+	parser := simpleTestParser(`print 1 + 1; "hello";`, t)
+	statements, _ := parser.parse()
+
+	if len(statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %d", len(statements))
+	}
+	if _, ok := statements[0].(*Print); !ok {
+		t.Errorf("Expected first statement to be a print statement, got %T", statements[0])
+	}
+	if _, ok := statements[1].(*Expression); !ok {
+		t.Errorf("Expected second statement to be an expression statement, got %T", statements[1])
+	}
+}
+
+func TestParserLogicalPrecedence(t *testing.T) {
+	parser := simpleTestParser(`a or b and c ? 1 : 2`, t)
+	expression, _ := parser.expression()
+	expected := `(?: (or a (and b c)) 1.0 2.0)`
+	actual, _ := NewAstPrinter().print(expression)
+	if actual != expected {
+		t.Errorf(
+			"Incorrect parsing.\n\nExpected: %s\nGot: %s",
+			expected, actual,
+		)
+	}
+}
+
+func TestParserDesugarsForLoop(t *testing.T) {
+	parser := simpleTestParser(`for (var i = 0; i < 3; i = i + 1) print i;`, t)
+	statements, _ := parser.parse()
+
+	outer, ok := statements[0].(*Block)
+	if !ok || len(outer.Statements) != 2 {
+		t.Fatalf("Expected for loop to desugar into an initializer block, got %#v", statements[0])
+	}
+	if _, ok := outer.Statements[0].(*Var); !ok {
+		t.Errorf("Expected the initializer to come first, got %T", outer.Statements[0])
+	}
+	loop, ok := outer.Statements[1].(*While)
+	if !ok {
+		t.Fatalf("Expected a while loop after the initializer, got %T", outer.Statements[1])
+	}
+	if body, ok := loop.Body.(*Block); !ok || len(body.Statements) != 2 {
+		t.Errorf("Expected the loop body to be followed by the increment, got %#v", loop.Body)
+	}
+}
+
+func TestParserReportsEveryError(t *testing.T) {
+	parser := simpleTestParser("var = 1;\nprint (1 + ;\nprint 2;\nfun f( {}\n", t)
+	statements, errs := parser.parse()
+
+	expected := []string{
+		"[Line 1] Error at '=': Expect variable name.",
+		"[Line 2] Error at ';': Expect expression.",
+		"[Line 4] Error at '{': Expect parameter name.",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("Expected: %s Actual: %s", expected[i], err.Error())
+		}
+	}
+
+	if len(statements) != 1 {
+		t.Fatalf("Expected the valid statement to survive recovery, got %d statements", len(statements))
+	}
+	if _, ok := statements[0].(*Print); !ok {
+		t.Errorf("Expected a print statement, got %T", statements[0])
+	}
+}
+
+func TestParserRecoversInsideBlocks(t *testing.T) {
+	parser := simpleTestParser("{ var a = ; print 1; }\nprint 2;", t)
+	statements, errs := parser.parse()
+
+	if len(errs) != 1 {
+		t.Fatalf("Expected a single error, got %v", errs)
+	}
+	if len(statements) != 2 {
+		t.Fatalf("Expected the block and the trailing print, got %d statements", len(statements))
+	}
+	if block := statements[0].(*Block); len(block.Statements) != 1 {
+		t.Errorf("Expected the block to keep its valid statement, got %d", len(block.Statements))
+	}
+}
+
+func TestParserInvalidAssignmentTargetDoesNotUnwind(t *testing.T) {
+	parser := simpleTestParser("1 + 2 = 3; print 4;", t)
+	statements, errs := parser.parse()
+
+	expected := "[Line 1] Error at '=': Invalid assignment target."
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("Expected: %s Actual: %v", expected, errs)
+	}
+	if len(statements) != 2 {
+		t.Errorf("Expected parsing to continue past the bad target, got %d statements", len(statements))
+	}
+}
+
+func TestParserRecordsSpans(t *testing.T) {
+	parser := simpleTestParser("print 1 +\n  foo(2, 3);", t)
+	statements, errs := parser.parse()
+	if len(errs) > 0 {
+		t.Fatalf("Expected source to parse cleanly, got %v", errs)
+	}
+
+	print := statements[0].(*Print)
+	sum := print.Expression.(*Binary)
+	call := sum.Right.(*Call)
+
+	testcases := map[string]struct {
+		node     Node
+		expected string
+	}{
+		"print statement": {print, "0:0-1:12"},
+		"binary":          {sum, "0:6-1:11"},
+		"left operand":    {sum.Left, "0:6-0:7"},
+		"call":            {call, "1:2-1:11"},
+		"argument":        {call.Arguments[1], "1:9-1:10"},
+	}
+
+	for name, tc := range testcases {
+		if actual := tc.node.Span().String(); actual != tc.expected {
+			t.Errorf("Span of %s incorrect.\n\nExpected: %s\nGot: %s", name, tc.expected, actual)
+		}
+	}
+}
+
 func TestParserNotIsAtEnd(t *testing.T) {
 	parser := simpleTestParser("123", t)
 	if parser.isAtEnd() {
@@ -225,7 +356,7 @@ func TestParserConsumeFails(t *testing.T) {
 		t.Errorf("Expected consume to return an error")
 	}
 
-	expected := "[Line 0] Error at end: Expect ')' after expression\n"
+	expected := "[Line 1] Error at end: Expect ')' after expression"
 	actual := err.Error()
 	if err.Error() != expected {
 		t.Errorf(
@@ -0,0 +1,593 @@
+package glox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+)
+
+// A .loxc file starts with bytecodeMagic, then the format version as two
+// bytes, big end first, then the SHA-256 of the source it was compiled from.
+// The script's function follows, each function being its name, arity and
+// upvalue count, its code, its line table and its constants. Numbers are
+// unsigned varints, and the line table is stored as runs of bytes sharing a
+// span rather than a span for every byte. The file ends with the SHA-256 of
+// everything before it, so a damaged file is caught before it's run.
+//
+// bytecodeVersion has to go up whenever the opcodes or the layout change.
+const (
+	bytecodeMagic   = "LOXC"
+	bytecodeVersion = 3
+)
+
+// Constants in a .loxc file are tagged with their type.
+const (
+	constantNumber byte = iota
+	constantString
+	constantFunction
+)
+
+var (
+	// ErrNotBytecode is the error reading something that isn't a .loxc file.
+	ErrNotBytecode = errors.New("not a .loxc file")
+	// ErrBytecodeVersion is the error reading a .loxc file written in a
+	// format this version of glox doesn't understand.
+	ErrBytecodeVersion = errors.New("incompatible .loxc format")
+	// ErrStaleBytecode is the error reading a .loxc file compiled from
+	// different source than the source it's being loaded for.
+	ErrStaleBytecode = errors.New("compiled from different source")
+	// ErrCorruptBytecode is the error reading a .loxc file that's been
+	// damaged, or whose code the vm couldn't safely run.
+	ErrCorruptBytecode = errors.New("corrupt .loxc file")
+)
+
+// Program is a script compiled to bytecode, which can be saved to a .loxc
+// file and read back to run without scanning, parsing or compiling it again.
+// It only runs on EngineVM.
+type Program struct {
+	script *vmFunction
+	source string
+}
+
+// Compile compiles source to a Program. Problems with the source are
+// reported on stderr and returned, as Run does.
+func (r *Runtime) Compile(source string) (*Program, error) {
+	r.source = source
+
+	script, err := r.compileBytecode(source)
+	if list, ok := err.(ErrorList); ok {
+		r.reportErrors(list)
+		return nil, err
+	}
+	return &Program{script: script, source: source}, nil
+}
+
+// RunProgram runs a compiled program as Run runs source: any errors are
+// reported on stderr as diagnostics, then returned.
+func (r *Runtime) RunProgram(ctx context.Context, program *Program) error {
+	if r.vm == nil {
+		return errors.New("programs only run on the vm engine")
+	}
+	r.source = program.source
+
+	_, err := r.interpret(ctx, program)
+	if err != nil {
+		if _, ok := err.(*runtimeError); !ok {
+			err = RuntimeError(0, err)
+		}
+		r.reportError(err)
+	}
+	return err
+}
+
+// interpret runs program on the vm. verify makes sure the code has the values
+// it needs on the stack, but can't know what they'll be, so a program written
+// wrongly can still hand an instruction something it can't use. That's
+// reported as corrupt bytecode rather than taking the host down with it.
+func (r *Runtime) interpret(ctx context.Context, program *Program) (result Value, err error) {
+	stackTop, frameCount := len(r.vm.stack), len(r.vm.frames)
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%w: %v", ErrCorruptBytecode, p)
+			r.vm.unwindOnError(&err, stackTop, frameCount)
+		}
+	}()
+	return r.vm.Interpret(ctx, program.script)
+}
+
+// WriteTo writes the program out in the .loxc format.
+func (p *Program) WriteTo(w io.Writer) (int64, error) {
+	bw := &bytecodeWriter{w: bufio.NewWriter(w), sum: sha256.New()}
+	hash := sha256.Sum256([]byte(p.source))
+
+	bw.write([]byte(bytecodeMagic))
+	bw.write([]byte{bytecodeVersion >> 8, bytecodeVersion & 0xff})
+	bw.write(hash[:])
+	bw.function(p.script)
+	bw.write(bw.sum.Sum(nil))
+	if bw.err == nil {
+		bw.err = bw.w.Flush()
+	}
+	return bw.n, bw.err
+}
+
+// ReadProgram reads a program in the .loxc format, which must have been
+// compiled from source. Anything else is rejected: files that aren't .loxc
+// with ErrNotBytecode, ones in another format version with
+// ErrBytecodeVersion, ones compiled from other source with
+// ErrStaleBytecode, and damaged ones with ErrCorruptBytecode.
+func ReadProgram(r io.Reader, source string) (*Program, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := data[:0]
+	if len(data) >= sha256.Size {
+		data, checksum = data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	}
+	br := &bytecodeReader{r: bytes.NewReader(data)}
+
+	magic := br.bytes(len(bytecodeMagic))
+	if br.err != nil || string(magic) != bytecodeMagic {
+		return nil, ErrNotBytecode
+	}
+
+	version := br.bytes(2)
+	if br.err != nil {
+		return nil, ErrNotBytecode
+	}
+	if v := int(version[0])<<8 | int(version[1]); v != bytecodeVersion {
+		return nil, fmt.Errorf("%w: version %d, expected %d", ErrBytecodeVersion, v, bytecodeVersion)
+	}
+
+	if sum := sha256.Sum256(data); !bytes.Equal(checksum, sum[:]) {
+		return nil, fmt.Errorf("%w: checksum doesn't match", ErrCorruptBytecode)
+	}
+
+	hash := sha256.Sum256([]byte(source))
+	if stored := br.bytes(len(hash)); br.err == nil && !bytes.Equal(stored, hash[:]) {
+		return nil, ErrStaleBytecode
+	}
+
+	script := br.function()
+	if br.err == nil {
+		br.err = verify(script)
+	}
+	if br.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBytecode, br.err)
+	}
+	return &Program{script: script, source: source}, nil
+}
+
+// bytecodeWriter writes a program out, remembering the first error so the
+// rest of the writes can go ahead without checking.
+type bytecodeWriter struct {
+	w   *bufio.Writer
+	sum hash.Hash
+	n   int64
+	err error
+}
+
+func (bw *bytecodeWriter) write(b []byte) {
+	if bw.err != nil {
+		return
+	}
+	bw.sum.Write(b)
+	n, err := bw.w.Write(b)
+	bw.n += int64(n)
+	bw.err = err
+}
+
+func (bw *bytecodeWriter) uint(x int) {
+	var buf [binary.MaxVarintLen64]byte
+	bw.write(buf[:binary.PutUvarint(buf[:], uint64(x))])
+}
+
+func (bw *bytecodeWriter) string(s string) {
+	bw.uint(len(s))
+	bw.write([]byte(s))
+}
+
+func (bw *bytecodeWriter) function(f *vmFunction) {
+	bw.string(f.name)
+	bw.uint(f.arity)
+	bw.uint(f.upvalueCount)
+
+	chunk := f.chunk
+	bw.uint(len(chunk.code))
+	bw.write(chunk.code)
+
+	var runs []int
+	for offset := range chunk.spans {
+		if offset == 0 || chunk.spans[offset] != chunk.spans[offset-1] {
+			runs = append(runs, offset)
+		}
+	}
+	bw.uint(len(runs))
+	for idx, start := range runs {
+		end := len(chunk.spans)
+		if idx+1 < len(runs) {
+			end = runs[idx+1]
+		}
+		bw.uint(end - start)
+		bw.span(chunk.spans[start])
+	}
+
+	bw.uint(len(chunk.constants))
+	for _, constant := range chunk.constants {
+		switch constant := constant.Interface().(type) {
+		case float64:
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], math.Float64bits(constant))
+			bw.write([]byte{constantNumber})
+			bw.write(buf[:])
+		case string:
+			bw.write([]byte{constantString})
+			bw.string(constant)
+		case *vmFunction:
+			bw.write([]byte{constantFunction})
+			bw.function(constant)
+		default:
+			bw.err = fmt.Errorf("can't write constant %v", constant)
+		}
+	}
+}
+
+func (bw *bytecodeWriter) span(span Span) {
+	for _, position := range []Position{span.Start, span.End} {
+		bw.uint(position.Offset)
+		bw.uint(position.Line)
+		bw.uint(position.Column)
+	}
+}
+
+// bytecodeReader reads a program back in, remembering the first error as
+// bytecodeWriter does.
+type bytecodeReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+// maxBytecodeLength stops a corrupt length from allocating more than any
+// real script would need.
+const maxBytecodeLength = 1 << 28
+
+func (br *bytecodeReader) bytes(n int) []byte {
+	if br.err != nil {
+		return nil
+	}
+	if n > br.r.Len() {
+		br.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := make([]byte, n)
+	_, br.err = io.ReadFull(br.r, b)
+	return b
+}
+
+func (br *bytecodeReader) byte() byte {
+	if b := br.bytes(1); br.err == nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (br *bytecodeReader) uint() int {
+	if br.err != nil {
+		return 0
+	}
+	x, err := binary.ReadUvarint(br.r)
+	if err == nil && x > maxBytecodeLength {
+		err = fmt.Errorf("%d is out of range", x)
+	}
+	br.err = err
+	return int(x)
+}
+
+func (br *bytecodeReader) string() string {
+	return string(br.bytes(br.uint()))
+}
+
+func (br *bytecodeReader) function() *vmFunction {
+	f := &vmFunction{name: br.string(), arity: br.uint(), upvalueCount: br.uint(), chunk: &Chunk{}}
+
+	chunk := f.chunk
+	chunk.code = br.bytes(br.uint())
+
+	runs := br.uint()
+	for idx := 0; idx < runs && br.err == nil; idx++ {
+		length := br.uint()
+		span := br.span()
+		for ; length > 0 && len(chunk.spans) < len(chunk.code); length-- {
+			chunk.spans = append(chunk.spans, span)
+		}
+	}
+	if br.err == nil && len(chunk.spans) != len(chunk.code) {
+		br.err = errors.New("line table doesn't cover the code")
+	}
+
+	constants := br.uint()
+	for idx := 0; idx < constants && br.err == nil; idx++ {
+		switch tag := br.byte(); tag {
+		case constantNumber:
+			if b := br.bytes(8); br.err == nil {
+				chunk.constants = append(chunk.constants, NumberValue(math.Float64frombits(binary.BigEndian.Uint64(b))))
+			}
+		case constantString:
+			chunk.constants = append(chunk.constants, StringValue(br.string()))
+		case constantFunction:
+			chunk.constants = append(chunk.constants, functionValue(br.function()))
+		default:
+			if br.err == nil {
+				br.err = fmt.Errorf("unknown constant type %d", tag)
+			}
+		}
+	}
+	return f
+}
+
+func (br *bytecodeReader) span() Span {
+	var positions [2]Position
+	for idx := range positions {
+		positions[idx] = Position{Offset: br.uint(), Line: br.uint(), Column: br.uint()}
+	}
+	return Span{positions[0], positions[1]}
+}
+
+// codeVerifier reads through a function's code as the vm would, remembering
+// the first problem as bytecodeReader does.
+type codeVerifier struct {
+	f   *vmFunction
+	ip  int
+	at  int
+	err error
+}
+
+// verifiedInstruction is an instruction as verify read it: where it starts,
+// where the next one starts, and the operands that decide how it uses the
+// stack and where it goes next.
+type verifiedInstruction struct {
+	op       opCode
+	at       int
+	next     int
+	operand  int
+	target   int
+	captures []int
+}
+
+// verify checks that the vm can run f, and the functions it defines, without
+// reading past the end of the code, the constants, the upvalues or the
+// stack: every opcode is known, every constant exists and is what the
+// instruction expects, every jump lands on an instruction, and every
+// instruction finds the values it needs on the stack. The checksum catches a
+// damaged file; this catches one written wrongly in the first place.
+func verify(f *vmFunction) error {
+	v := &codeVerifier{f: f}
+	code := f.chunk.code
+
+	var instructions []verifiedInstruction
+	starts := make(map[int]int)
+	for v.ip < len(code) && v.err == nil {
+		v.at = v.ip
+		instruction := verifiedInstruction{at: v.at}
+
+		op := v.opCode()
+		constants, slots := constantSize, slotSize
+		if op == opWide {
+			op = v.opCode()
+			constants, slots = wideSize, wideSize
+		}
+		instruction.op = op
+
+		switch op {
+		case opNil, opTrue, opFalse, opPop, opEqual, opGreater, opGreaterEqual, opLess, opLessEqual,
+			opAdd, opSubtract, opMultiply, opDivide, opNot, opNegate, opPrint, opCloseUpvalue,
+			opReturn, opInherit:
+		case opConstant:
+			v.constant(constants, NumberKind, StringKind)
+		case opGetGlobal, opDefineGlobal, opSetGlobal, opGetProperty, opSetProperty, opGetSuper,
+			opClass, opMethod:
+			v.constant(constants, StringKind)
+		case opGetLocal, opSetLocal:
+			instruction.operand = v.operand(slots)
+		case opCall:
+			// The vm always reads an argument count from one byte.
+			instruction.operand = v.operand(1)
+		case opGetUpvalue, opSetUpvalue:
+			v.upvalue(v.operand(slots))
+		case opJump, opJumpIfFalse:
+			offset := v.operand(jumpSize)
+			instruction.target = v.ip + offset
+		case opLoop:
+			offset := v.operand(jumpSize)
+			instruction.target = v.ip - offset
+		case opClosure:
+			function, ok := v.constant(constants, FunctionKind).object().(*vmFunction)
+			if !ok {
+				v.fail("closure of something that isn't a function")
+			}
+			for idx := 0; v.err == nil && idx < function.upvalueCount; idx++ {
+				isLocal, index := v.operand(1), v.operand(slots)
+				if isLocal > 1 {
+					v.fail("upvalue flag %d", isLocal)
+				} else if isLocal == 0 {
+					v.upvalue(index)
+				} else {
+					instruction.captures = append(instruction.captures, index)
+				}
+			}
+		default:
+			v.fail("unknown opcode %d", op)
+		}
+
+		instruction.next = v.ip
+		starts[instruction.at] = len(instructions)
+		instructions = append(instructions, instruction)
+	}
+
+	if v.err == nil && (len(code) == 0 || instructions[len(instructions)-1].op != opReturn) {
+		v.fail("code doesn't end with a return")
+	}
+	for _, instruction := range instructions {
+		if _, ok := starts[instruction.target]; v.err == nil && isJump(instruction.op) && !ok {
+			v.at = instruction.at
+			v.fail("jump to %d, which isn't an instruction", instruction.target)
+		}
+	}
+	if v.err == nil {
+		v.stackHeights(instructions, starts)
+	}
+
+	for _, constant := range f.chunk.constants {
+		if nested, ok := constant.object().(*vmFunction); ok && v.err == nil {
+			v.err = verify(nested)
+		}
+	}
+	return v.err
+}
+
+// stackHeights follows every path through the code from the start of the
+// function, where the stack holds the callee and its arguments, working out
+// how many values each instruction finds on the stack. The vm doesn't check
+// as it runs, so no instruction may take more values than there are, reach
+// past them for a local, or find a different number depending on how it was
+// reached. Code no path reaches is never run, so it isn't held to this.
+func (v *codeVerifier) stackHeights(instructions []verifiedInstruction, starts map[int]int) {
+	heights := make([]int, len(instructions))
+	for idx := range heights {
+		heights[idx] = -1
+	}
+	heights[0] = v.f.arity + 1
+
+	pending := []int{0}
+	for len(pending) > 0 && v.err == nil {
+		idx := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		instruction := instructions[idx]
+		height := heights[idx]
+		v.at = instruction.at
+
+		pops, pushes := stackEffect(instruction)
+		if pops > height {
+			v.fail("%s needs %d values on the stack but there are %d", instruction.op, pops, height)
+			return
+		}
+		switch instruction.op {
+		case opGetLocal, opSetLocal:
+			if instruction.operand >= height {
+				v.fail("local slot %d is past the %d values on the stack", instruction.operand, height)
+			}
+		case opClosure:
+			// A local function captures itself, in the slot the closure is
+			// about to be pushed into.
+			for _, slot := range instruction.captures {
+				if slot > height {
+					v.fail("captured slot %d is past the %d values on the stack", slot, height)
+				}
+			}
+		}
+		height += pushes - pops
+
+		var successors []int
+		switch instruction.op {
+		case opReturn:
+		case opJump, opLoop:
+			successors = []int{instruction.target}
+		case opJumpIfFalse:
+			successors = []int{instruction.next, instruction.target}
+		default:
+			successors = []int{instruction.next}
+		}
+		for _, successor := range successors {
+			next := starts[successor]
+			if heights[next] == -1 {
+				heights[next] = height
+				pending = append(pending, next)
+			} else if heights[next] != height && v.err == nil {
+				v.fail("%d values on the stack going to %d, which is also reached with %d", height, successor, heights[next])
+			}
+		}
+	}
+}
+
+// stackEffect is how many values an instruction takes off the stack and how
+// many it leaves in their place. Those that only look at the top value count
+// it as taken and put back.
+func stackEffect(instruction verifiedInstruction) (pops, pushes int) {
+	switch instruction.op {
+	case opConstant, opNil, opTrue, opFalse, opGetLocal, opGetGlobal, opGetUpvalue, opClosure, opClass:
+		return 0, 1
+	case opPop, opDefineGlobal, opPrint, opCloseUpvalue, opReturn:
+		return 1, 0
+	case opSetLocal, opSetGlobal, opSetUpvalue, opGetProperty, opNot, opNegate, opJumpIfFalse:
+		return 1, 1
+	case opSetProperty, opGetSuper, opEqual, opGreater, opGreaterEqual, opLess, opLessEqual,
+		opAdd, opSubtract, opMultiply, opDivide, opInherit, opMethod:
+		return 2, 1
+	case opCall:
+		return instruction.operand + 1, 1
+	default:
+		return 0, 0
+	}
+}
+
+func isJump(op opCode) bool {
+	return op == opJump || op == opJumpIfFalse || op == opLoop
+}
+
+func (v *codeVerifier) fail(format string, args ...interface{}) {
+	if v.err == nil {
+		v.err = fmt.Errorf("%s at %d: %s", v.f, v.at, fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *codeVerifier) opCode() opCode {
+	return opCode(v.operand(1))
+}
+
+func (v *codeVerifier) operand(size int) int {
+	if v.err == nil && v.ip+size > len(v.f.chunk.code) {
+		v.fail("code ends part way through an instruction")
+	}
+	if v.err != nil {
+		return 0
+	}
+	operand := v.f.chunk.readOperand(v.ip, size)
+	v.ip += size
+	return operand
+}
+
+// constant reads a constant operand, which has to be one of kinds.
+func (v *codeVerifier) constant(size int, kinds ...Kind) Value {
+	idx := v.operand(size)
+	if v.err != nil {
+		return Nil
+	}
+	if idx >= len(v.f.chunk.constants) {
+		v.fail("constant %d doesn't exist", idx)
+		return Nil
+	}
+
+	constant := v.f.chunk.constants[idx]
+	for _, kind := range kinds {
+		if constant.Kind() == kind {
+			return constant
+		}
+	}
+	v.fail("constant %d is a %s", idx, constant.Kind())
+	return Nil
+}
+
+func (v *codeVerifier) upvalue(index int) {
+	if v.err == nil && index >= v.f.upvalueCount {
+		v.fail("upvalue %d doesn't exist", index)
+	}
+}
@@ -0,0 +1,181 @@
+package glox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+const programSource = `
+fun greet(name) { return "hello " + name; }
+class Counter {
+	init() { this.count = 0; }
+	inc() { this.count = this.count + 1; return this; }
+}
+print greet("world");
+print Counter().inc().inc().count * 1.5;
+print undefinedThing;
+`
+
+func compileProgram(t *testing.T) *bytes.Buffer {
+	program, err := New(WithEngine(EngineVM)).Compile(programSource)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := program.WriteTo(&buf); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return &buf
+}
+
+func TestProgramRoundTrip(t *testing.T) {
+	program, err := ReadProgram(compileProgram(t), programSource)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var fromFile, fromSource bytes.Buffer
+	runtime := New(WithEngine(EngineVM), WithStdout(&fromFile), WithStderr(&fromFile), WithFileName("test.lox"))
+	if err := runtime.RunProgram(context.Background(), program); err == nil {
+		t.Errorf("Expected the undefined variable error")
+	}
+	New(WithStdout(&fromSource), WithStderr(&fromSource), WithFileName("test.lox")).Run(programSource, 0)
+
+	if fromFile.String() != fromSource.String() {
+		t.Errorf("Expected:\n%s\nActual:\n%s", fromSource.String(), fromFile.String())
+	}
+}
+
+func TestReadProgramRejects(t *testing.T) {
+	stale := compileProgram(t)
+	newer := compileProgram(t).Bytes()
+	newer[len(bytecodeMagic)+1]++
+	truncated := compileProgram(t).Bytes()
+	truncated = truncated[:len(truncated)-10]
+	damaged := compileProgram(t).Bytes()
+	damaged[43], damaged[44] = 0x7f, 0xff
+
+	testcases := map[string]struct {
+		file   io.Reader
+		source string
+		err    error
+	}{
+		"stale":     {stale, programSource + "print 1;", ErrStaleBytecode},
+		"version":   {bytes.NewReader(newer), programSource, ErrBytecodeVersion},
+		"not loxc":  {bytes.NewReader([]byte("print 1;")), programSource, ErrNotBytecode},
+		"empty":     {bytes.NewReader(nil), programSource, ErrNotBytecode},
+		"truncated": {bytes.NewReader(truncated), programSource, ErrCorruptBytecode},
+		"damaged":   {bytes.NewReader(damaged), programSource, ErrCorruptBytecode},
+		"local":     {programFile(t, byte(opGetLocal), 200, byte(opReturn)), "", ErrCorruptBytecode},
+		"pop":       {programFile(t, byte(opPop), byte(opPop), byte(opReturn)), "", ErrCorruptBytecode},
+		"call":      {programFile(t, byte(opCall), 9, byte(opReturn)), "", ErrCorruptBytecode},
+		"inherit":   {programFile(t, byte(opInherit), byte(opReturn)), "", ErrCorruptBytecode},
+		"merge": {programFile(t,
+			byte(opTrue), byte(opJumpIfFalse), 0, 0, 0, 1, byte(opNil), byte(opReturn),
+		), "", ErrCorruptBytecode},
+	}
+
+	for name, testcase := range testcases {
+		_, err := ReadProgram(testcase.file, testcase.source)
+		if !errors.Is(err, testcase.err) {
+			t.Errorf("%s: Expected: %v Actual: %v", name, testcase.err, err)
+		}
+	}
+}
+
+func TestReadProgramVerifiesCode(t *testing.T) {
+	testcases := map[string]func(chunk *Chunk){
+		"constant":      func(chunk *Chunk) { chunk.code[1], chunk.code[2] = 0x7f, 0xff },
+		"opcode":        func(chunk *Chunk) { chunk.code[0] = 0xee },
+		"constant kind": func(chunk *Chunk) { chunk.code[0] = byte(opConstant) },
+		"no return":     func(chunk *Chunk) { chunk.code[len(chunk.code)-1] = byte(opPop) },
+		"jump": func(chunk *Chunk) {
+			chunk.code = append(chunk.code, byte(opJump), 0, 0, 0, 1, byte(opReturn))
+			chunk.spans = append(chunk.spans, make([]Span, 6)...)
+		},
+	}
+
+	for name, tamper := range testcases {
+		program, err := New(WithEngine(EngineVM)).Compile(programSource)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		tamper(program.script.chunk)
+
+		var buf bytes.Buffer
+		if _, err := program.WriteTo(&buf); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if _, err := ReadProgram(&buf, programSource); !errors.Is(err, ErrCorruptBytecode) {
+			t.Errorf("%s: Expected: %v Actual: %v", name, ErrCorruptBytecode, err)
+		}
+	}
+}
+
+func TestReadProgramAcceptsCompiledCode(t *testing.T) {
+	sources := []string{
+		"{ fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); } print fib(5); }",
+		"for (var i = 0; i < 3; i = i + 1) { var j = i; fun f() { return j; } print f() and i or nil; }",
+		"class A { m() { return 1; } } class B < A { m() { var s = super.m; return s() + 1; } } print B().m();",
+		"fun f(a, b, c) { { var d = a; return d + b + c; } print \"unreachable\"; } print f(1, 2, 3);",
+	}
+
+	for _, source := range sources {
+		program, err := New(WithEngine(EngineVM)).Compile(source)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		var buf bytes.Buffer
+		if _, err := program.WriteTo(&buf); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if _, err := ReadProgram(&buf, source); err != nil {
+			t.Errorf("%s: Unexpected error %v", source, err)
+		}
+	}
+}
+
+func TestRunProgramRecoversFromWrongValues(t *testing.T) {
+	// The stack has the two values GET_SUPER needs, but neither is what it
+	// expects, which only shows when it runs.
+	file := programFile(t, byte(opNil), byte(opNil), byte(opGetSuper), 0, 0, byte(opReturn))
+	program, err := ReadProgram(file, "")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	runtime := New(WithEngine(EngineVM), WithStderr(io.Discard))
+	if err := runtime.RunProgram(context.Background(), program); !errors.Is(err, ErrCorruptBytecode) {
+		t.Errorf("Expected: %v Actual: %v", ErrCorruptBytecode, err)
+	}
+	if value, err := runtime.Eval(context.Background(), "1 + 2;"); err != nil || value != NumberValue(3) {
+		t.Errorf("Expected the vm to carry on afterwards, got %v, %v", value, err)
+	}
+}
+
+func TestRunProgramNeedsVM(t *testing.T) {
+	program, err := New().Compile("print 1;")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := New().RunProgram(context.Background(), program); err == nil {
+		t.Errorf("Expected an error running a program on the tree-walker")
+	}
+}
+
+// programFile is a .loxc file, with good checksums, for a script of the empty
+// source whose code is code.
+func programFile(t *testing.T, code ...byte) io.Reader {
+	chunk := &Chunk{code: code, constants: []Value{StringValue("x")}, spans: make([]Span, len(code))}
+	program := &Program{script: &vmFunction{chunk: chunk}}
+
+	var buf bytes.Buffer
+	if _, err := program.WriteTo(&buf); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return &buf
+}
@@ -0,0 +1,337 @@
+package glox
+
+import "errors"
+
+type functionType int
+
+const (
+	functionNone functionType = iota
+	functionFunction
+	functionInitializer
+	functionMethod
+)
+
+type classType int
+
+const (
+	classNone classType = iota
+	classClass
+	classSubclass
+)
+
+// resolution is embedded in the expressions that refer to a variable, and
+// records where the resolver found it: depth environments out from the
+// reference. Keeping it on the node rather than in the interpreter means it
+// goes away with the program that was resolved.
+type resolution struct {
+	depth    int
+	resolved bool
+}
+
+func (r *resolution) resolveAt(depth int) {
+	r.depth, r.resolved = depth, true
+}
+
+// scopeDepth is the variable's depth, or false if it wasn't resolved and is
+// a global.
+func (r *resolution) scopeDepth() (int, bool) {
+	return r.depth, r.resolved
+}
+
+// localExpr is an expression that refers to a variable.
+type localExpr interface {
+	Expr
+	resolveAt(depth int)
+	scopeDepth() (int, bool)
+}
+
+// resolver walks the AST once before execution and tells the interpreter how
+// many environments separate each local variable reference from the scope
+// that declared it. Globals are left unresolved and looked up dynamically.
+type resolver struct {
+	interpreter     *interpreter
+	scopes          []map[string]bool
+	currentFunction functionType
+	currentClass    classType
+	errors          []error
+}
+
+func NewResolver(interpreter *interpreter) *resolver {
+	return &resolver{
+		interpreter:     interpreter,
+		scopes:          make([]map[string]bool, 0),
+		currentFunction: functionNone,
+		currentClass:    classNone,
+	}
+}
+
+func (r *resolver) Resolve(statements []Stmt) []error {
+	r.resolveStmts(statements)
+	return r.errors
+}
+
+func (r *resolver) visitBlockStmt(stmt *Block) (interface{}, error) {
+	r.beginScope()
+	r.resolveStmts(stmt.Statements)
+	r.endScope()
+	return nil, nil
+}
+
+func (r *resolver) visitClassStmt(stmt *Class) (interface{}, error) {
+	enclosingClass := r.currentClass
+	r.currentClass = classClass
+
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+
+	if stmt.Superclass != nil {
+		if stmt.Name.lexeme == stmt.Superclass.Name.lexeme {
+			r.error(stmt.Superclass.Name, "A class can't inherit from itself.")
+		}
+
+		r.currentClass = classSubclass
+		r.resolveExpr(stmt.Superclass)
+
+		r.beginScope()
+		r.scopes[len(r.scopes)-1]["super"] = true
+	}
+
+	r.beginScope()
+	r.scopes[len(r.scopes)-1]["this"] = true
+
+	for _, method := range stmt.Methods {
+		declaration := functionMethod
+		if method.Name.lexeme == "init" {
+			declaration = functionInitializer
+		}
+		r.resolveFunction(method, declaration)
+	}
+
+	r.endScope()
+
+	if stmt.Superclass != nil {
+		r.endScope()
+	}
+
+	r.currentClass = enclosingClass
+	return nil, nil
+}
+
+func (r *resolver) visitVarStmt(stmt *Var) (interface{}, error) {
+	r.declare(stmt.Name)
+	if stmt.Initializer != nil {
+		r.resolveExpr(stmt.Initializer)
+	}
+	r.define(stmt.Name)
+	return nil, nil
+}
+
+func (r *resolver) visitFunctionStmt(stmt *Function) (interface{}, error) {
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+
+	r.resolveFunction(stmt, functionFunction)
+	return nil, nil
+}
+
+func (r *resolver) visitExpressionStmt(stmt *Expression) (interface{}, error) {
+	r.resolveExpr(stmt.Expression)
+	return nil, nil
+}
+
+func (r *resolver) visitIfStmt(stmt *If) (interface{}, error) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		r.resolveStmt(stmt.ElseBranch)
+	}
+	return nil, nil
+}
+
+func (r *resolver) visitPrintStmt(stmt *Print) (interface{}, error) {
+	r.resolveExpr(stmt.Expression)
+	return nil, nil
+}
+
+func (r *resolver) visitReturnStmt(stmt *Return) (interface{}, error) {
+	if r.currentFunction == functionNone {
+		r.error(stmt.Keyword, "Can't return from top-level code.")
+	}
+
+	if stmt.Value != nil {
+		if r.currentFunction == functionInitializer {
+			r.error(stmt.Keyword, "Can't return a value from an initializer.")
+		}
+		r.resolveExpr(stmt.Value)
+	}
+	return nil, nil
+}
+
+func (r *resolver) visitWhileStmt(stmt *While) (interface{}, error) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.Body)
+	return nil, nil
+}
+
+func (r *resolver) visitVariableExpr(expr *Variable) (interface{}, error) {
+	if len(r.scopes) > 0 {
+		if defined, declared := r.scopes[len(r.scopes)-1][expr.Name.lexeme]; declared && !defined {
+			err := r.error(expr.Name, "Can't read local variable in its own initializer.")
+			err.hint = "give the new variable a different name if you meant the outer one"
+		}
+	}
+
+	r.resolveLocal(expr, expr.Name)
+	return nil, nil
+}
+
+func (r *resolver) visitAssignExpr(expr *Assign) (interface{}, error) {
+	r.resolveExpr(expr.Value)
+	r.resolveLocal(expr, expr.Name)
+	return nil, nil
+}
+
+func (r *resolver) visitBinaryExpr(expr *Binary) (interface{}, error) {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *resolver) visitCallExpr(expr *Call) (interface{}, error) {
+	r.resolveExpr(expr.Callee)
+	for _, argument := range expr.Arguments {
+		r.resolveExpr(argument)
+	}
+	return nil, nil
+}
+
+func (r *resolver) visitGetExpr(expr *Get) (interface{}, error) {
+	r.resolveExpr(expr.Object)
+	return nil, nil
+}
+
+func (r *resolver) visitSetExpr(expr *Set) (interface{}, error) {
+	r.resolveExpr(expr.Value)
+	r.resolveExpr(expr.Object)
+	return nil, nil
+}
+
+func (r *resolver) visitSuperExpr(expr *Super) (interface{}, error) {
+	if r.currentClass == classNone {
+		r.error(expr.Keyword, "Can't use 'super' outside of a class.")
+	} else if r.currentClass != classSubclass {
+		r.error(expr.Keyword, "Can't use 'super' in a class with no superclass.")
+	}
+
+	r.resolveLocal(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (r *resolver) visitThisExpr(expr *This) (interface{}, error) {
+	if r.currentClass == classNone {
+		r.error(expr.Keyword, "Can't use 'this' outside of a class.")
+		return nil, nil
+	}
+
+	r.resolveLocal(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (r *resolver) visitGroupingExpr(expr *Grouping) (interface{}, error) {
+	r.resolveExpr(expr.Expression)
+	return nil, nil
+}
+
+func (r *resolver) visitLiteralExpr(expr *Literal) (interface{}, error) {
+	return nil, nil
+}
+
+func (r *resolver) visitLogicalExpr(expr *Logical) (interface{}, error) {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *resolver) visitUnaryExpr(expr *Unary) (interface{}, error) {
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *resolver) visitTernaryExpr(expr *Ternary) (interface{}, error) {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Middle)
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *resolver) resolveStmts(statements []Stmt) {
+	for _, statement := range statements {
+		r.resolveStmt(statement)
+	}
+}
+
+func (r *resolver) resolveStmt(stmt Stmt) {
+	stmt.Accept(r)
+}
+
+func (r *resolver) resolveExpr(expr Expr) {
+	expr.Accept(r)
+}
+
+func (r *resolver) resolveFunction(function *Function, kind functionType) {
+	enclosingFunction := r.currentFunction
+	r.currentFunction = kind
+
+	r.beginScope()
+	for _, param := range function.Params {
+		r.declare(param)
+		r.define(param)
+	}
+	r.resolveStmts(function.Body)
+	r.endScope()
+
+	r.currentFunction = enclosingFunction
+}
+
+func (r *resolver) resolveLocal(expr localExpr, name *Token) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, ok := r.scopes[i][name.lexeme]; ok {
+			r.interpreter.resolve(expr, len(r.scopes)-1-i)
+			return
+		}
+	}
+}
+
+func (r *resolver) beginScope() {
+	r.scopes = append(r.scopes, make(map[string]bool))
+}
+
+func (r *resolver) endScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *resolver) declare(name *Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+
+	scope := r.scopes[len(r.scopes)-1]
+	if _, ok := scope[name.lexeme]; ok {
+		r.error(name, "Already a variable with this name in this scope.")
+	}
+	scope[name.lexeme] = false
+}
+
+func (r *resolver) define(name *Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	r.scopes[len(r.scopes)-1][name.lexeme] = true
+}
+
+func (r *resolver) error(token *Token, msg string) *parseError {
+	err := ParseError(token, errors.New(msg))
+	err.code = codeResolve
+	r.errors = append(r.errors, err)
+	return err
+}
@@ -0,0 +1,87 @@
+package glox
+
+import "testing"
+
+func TestResolverBindsClosuresStatically(t *testing.T) {
+	interpreter, err := interpretedSource(`
+	var a = "global";
+	var first;
+	var second;
+	{
+		fun showA() {
+			return a;
+		}
+
+		first = showA();
+		var a = "block";
+		second = showA();
+	}
+	`)
+	if err != nil {
+		t.Fatalf("Expected statements to run without error, got %v", err)
+	}
+
+	assertGlobal(interpreter, "first", StringValue("global"), t)
+	assertGlobal(interpreter, "second", StringValue("global"), t)
+}
+
+func TestResolverRecordsScopeDistances(t *testing.T) {
+	interpreter := NewInterpreter()
+	statements := resolvedStatements(`
+	var global = 1;
+	{
+		var outer = 2;
+		{
+			print outer + global;
+		}
+	}
+	`, interpreter, t)
+
+	inner := statements[1].(*Block).Statements[1].(*Block)
+	sum := inner.Statements[0].(*Print).Expression.(*Binary)
+
+	if distance, ok := sum.Left.(*Variable).scopeDepth(); !ok || distance != 1 {
+		t.Errorf("Expected 'outer' to resolve one scope up, got %d (resolved: %v)", distance, ok)
+	}
+	if _, ok := sum.Right.(*Variable).scopeDepth(); ok {
+		t.Errorf("Expected 'global' to be left for dynamic lookup")
+	}
+}
+
+func TestResolverErrors(t *testing.T) {
+	testcases := map[string]string{
+		`{ var a = a; }`:            "[Line 1] Error at 'a': Can't read local variable in its own initializer.",
+		`return 1;`:                 "[Line 1] Error at 'return': Can't return from top-level code.",
+		`{ var a = 1; var a = 2; }`: "[Line 1] Error at 'a': Already a variable with this name in this scope.",
+	}
+
+	for source, expected := range testcases {
+		tokens, _ := NewScanner(source).ScanTokens()
+		statements, _ := NewParser(tokens).parse()
+		errs := NewResolver(NewInterpreter()).Resolve(statements)
+
+		if len(errs) != 1 {
+			t.Errorf("Expected exactly one resolver error for '%s', got %v", source, errs)
+			continue
+		}
+		if errs[0].Error() != expected {
+			t.Errorf("Expected: %s Actual: %s", expected, errs[0].Error())
+		}
+	}
+}
+
+func TestResolverAllowsGlobalRedeclaration(t *testing.T) {
+	resolvedStatements(`var a = 1; var a = 2;`, NewInterpreter(), t)
+}
+
+func resolvedStatements(source string, interpreter *interpreter, t *testing.T) []Stmt {
+	tokens, _ := NewScanner(source).ScanTokens()
+	statements, errs := NewParser(tokens).parse()
+	if len(errs) > 0 {
+		t.Fatalf("Expected source to parse cleanly, got %v", errs)
+	}
+	if errs := NewResolver(interpreter).Resolve(statements); len(errs) > 0 {
+		t.Fatalf("Expected source to resolve cleanly, got %v", errs)
+	}
+	return statements
+}
@@ -1,77 +1,489 @@
 package glox
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 )
 
-type loxRuntime struct {
-	HadError bool
+// Runtime runs Lox source, either for the glox command or for a Go program
+// embedding Lox. Globals defined by one Eval or Run are still there for the
+// next, and can be called from Go with Call.
+//
+// A Runtime is not safe for concurrent use: give each goroutine its own. The
+// cheap way to do that for shared definitions is to load them into one
+// runtime and Clone it per goroutine.
+type Runtime struct {
+	fileName    string
+	source      string
+	diagnostics DiagnosticFormat
+	stderr      io.Writer
+	reporter    diagnosticReporter
+	engine      Engine
+	trace       io.Writer
+	interpreter *interpreter
+	vm          *vm
+}
+
+type RuntimeOption func(*Runtime)
+
+// Engine is how a Runtime runs scripts. Both engines share the scanner,
+// parser and resolver, and give the same output and errors.
+type Engine int
+
+const (
+	// EngineTree walks the syntax tree.
+	EngineTree Engine = iota
+	// EngineVM compiles to bytecode and runs it on a stack machine.
+	EngineVM
+)
+
+// ParseEngine reads an engine name, as given on the command line.
+func ParseEngine(name string) (Engine, error) {
+	switch name {
+	case "tree":
+		return EngineTree, nil
+	case "vm":
+		return EngineVM, nil
+	default:
+		return EngineTree, fmt.Errorf("unknown engine '%s'", name)
+	}
+}
+
+// WithEngine picks the engine scripts run on; the default is EngineTree.
+// Globals belong to the engine that defined them, so a Clone keeps the engine
+// of the runtime it was cloned from.
+func WithEngine(engine Engine) RuntimeOption {
+	return func(r *Runtime) {
+		r.engine = engine
+	}
+}
+
+// WithFileName names the script being run, for diagnostics to point at.
+func WithFileName(name string) RuntimeOption {
+	return func(r *Runtime) {
+		r.fileName = name
+	}
+}
+
+// WithDiagnostics picks how errors are reported on stderr.
+func WithDiagnostics(format DiagnosticFormat) RuntimeOption {
+	return func(r *Runtime) {
+		r.diagnostics = format
+	}
+}
+
+// WithStepLimit stops each Eval, Run or Call with ErrBudgetExceeded once it's
+// taken more than steps steps: top-level statements, loop iterations and
+// calls. Zero, the default, means no limit.
+func WithStepLimit(steps int) RuntimeOption {
+	return func(r *Runtime) {
+		r.interpreter.maxSteps = steps
+	}
+}
+
+// WithMaxCallDepth stops a script with a "Stack overflow." runtime error when
+// its calls nest more than depth deep. Zero leaves the default of 10000.
+func WithMaxCallDepth(depth int) RuntimeOption {
+	return func(r *Runtime) {
+		if depth > 0 {
+			r.interpreter.maxDepth = depth
+		}
+	}
+}
+
+// WithAllocationLimit stops each Eval, Run or Call with ErrAllocationLimit
+// once it's allocated roughly more than bytes bytes of strings and
+// instances. Zero, the default, means no limit.
+func WithAllocationLimit(bytes int) RuntimeOption {
+	return func(r *Runtime) {
+		r.interpreter.maxAlloc = bytes
+	}
+}
+
+// WithCapabilities lets scripts call natives that need capabilities. A
+// runtime starts with none, so untrusted scripts can't reach beyond it.
+func WithCapabilities(capabilities ...Capability) RuntimeOption {
+	return func(r *Runtime) {
+		for _, capability := range capabilities {
+			r.interpreter.granted[capability] = true
+		}
+	}
+}
+
+// WithHeapGrowth sets how much the heap may grow, as a multiple of what
+// survived the last garbage collection, before the next one runs. Factors of
+// 1 or less are ignored, leaving the default of 2.
+func WithHeapGrowth(factor float64) RuntimeOption {
+	return func(r *Runtime) {
+		if factor > 1 {
+			r.interpreter.gc.growth = factor
+		}
+	}
+}
+
+// WithStressGC collects garbage at every loop iteration and call rather than
+// once the heap has grown, which is slow but quick to turn up an object the
+// collector should have kept.
+func WithStressGC() RuntimeOption {
+	return func(r *Runtime) {
+		r.interpreter.gc.stress = true
+	}
+}
+
+// WithStdout sends the output of print statements to w instead of os.Stdout.
+func WithStdout(w io.Writer) RuntimeOption {
+	return func(r *Runtime) {
+		r.interpreter.stdout = w
+	}
+}
+
+// WithTraceExec writes each instruction the vm runs to w, after the values
+// on its stack. It only applies to EngineVM; the tree-walker has no
+// instructions to trace.
+func WithTraceExec(w io.Writer) RuntimeOption {
+	return func(r *Runtime) {
+		r.trace = w
+	}
+}
+
+// WithStderr sends the diagnostics reported by Run to w instead of os.Stderr.
+func WithStderr(w io.Writer) RuntimeOption {
+	return func(r *Runtime) {
+		r.stderr = w
+	}
+}
+
+// ErrorList is every error found in a piece of source before it could run.
+// Scanning, parsing and resolving all carry on past the first problem, so
+// there may be several.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for idx, err := range l {
+		messages[idx] = err.Error()
+	}
+	return strings.Join(messages, "\n")
 }
 
 type parseError struct {
 	line  int
 	where string
+	span  Span
+	code  string
+	hint  string
 	Err   error
 }
 
+type scanError struct {
+	line   int
+	column int
+	span   Span
+	hint   string
+	Err    error
+}
+
 type runtimeError struct {
 	line  int
 	where string
+	span  Span
+	hint  string
+	note  string
+	trace []StackFrame
 	Err   error
 }
 
+func ScanError(span Span, err error) *scanError {
+	return &scanError{line: span.Start.Line, column: span.Start.Column, span: span, Err: err}
+}
+
+// RuntimeError is for errors that can't be pinned on a token, so it only
+// knows the line.
 func RuntimeError(line int, err error) *runtimeError {
-	return &runtimeError{line, "0", err}
+	span := Span{Position{Line: line}, Position{Line: line}}
+	return &runtimeError{line: line, span: span, Err: err}
+}
+
+func TokenRuntimeError(token *Token, err error) *runtimeError {
+	return &runtimeError{line: token.line, span: token.Span(), Err: err}
+}
+
+func NodeRuntimeError(node Node, err error) *runtimeError {
+	return SpanRuntimeError(node.Span(), err)
+}
+
+func SpanRuntimeError(span Span, err error) *runtimeError {
+	return &runtimeError{line: span.Start.Line, span: span, Err: err}
 }
 
 func ParseError(token *Token, err error) *parseError {
+	where := fmt.Sprintf(" at '%s'", token.lexeme)
 	if token.tokenType == EOF {
-		return &parseError{token.line, " at end", err}
-	} else {
-		at := fmt.Sprintf(" at '%s'", token.lexeme)
-		return &parseError{token.line, at, err}
+		where = " at end"
 	}
+	return &parseError{line: token.line, where: where, span: token.Span(), code: codeParse, Err: err}
 }
 
 func (e *parseError) Error() string {
-	return fmt.Sprintf("[Line %d] Error%s: %v\n", e.line, e.where, e.Err)
+	return fmt.Sprintf("[Line %d] Error%s: %v", e.line+1, e.where, e.Err)
+}
+
+func (e *parseError) Diagnostic() Diagnostic {
+	return Diagnostic{Severity: SeverityError, Code: e.code, Message: e.Err.Error(), Span: e.span, Hint: e.hint}
+}
+
+func (e *scanError) Error() string {
+	return fmt.Sprintf("[Line %d] Error at column %d: %v", e.line+1, e.column+1, e.Err)
+}
+
+func (e *scanError) Diagnostic() Diagnostic {
+	return Diagnostic{Severity: SeverityError, Code: codeScan, Message: e.Err.Error(), Span: e.span, Hint: e.hint}
 }
 
 func (e *runtimeError) Error() string {
-	return fmt.Sprintf("[Line %d] Error%s: %v\n", e.line, e.where, e.Err)
+	return fmt.Sprintf("[Line %d] Error%s: %v", e.line+1, e.where, e.Err)
+}
+
+func (e *runtimeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *runtimeError) Diagnostic() Diagnostic {
+	return Diagnostic{
+		Severity: SeverityError,
+		Code:     codeRuntime,
+		Message:  e.Err.Error(),
+		Span:     e.span,
+		Hint:     e.hint,
+		Note:     e.note,
+		Trace:    e.trace,
+	}
 }
 
-func NewRuntime() *loxRuntime {
-	return &loxRuntime{
-		HadError: false,
+func New(opts ...RuntimeOption) *Runtime {
+	r := &Runtime{
+		diagnostics: DiagnosticsText,
+		stderr:      os.Stderr,
+		interpreter: NewInterpreter(),
 	}
+	r.configure(opts)
+	return r
 }
 
-func (r *loxRuntime) Run(source string, line int) {
-	if source == "exit" || source == "exit!" || source == "quit" {
-		os.Exit(0)
+func (r *Runtime) configure(opts []RuntimeOption) {
+	engine := r.engine
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.vm != nil {
+		r.engine = engine
+	} else if r.engine == EngineVM {
+		r.vm = NewVM()
+	}
+
+	// The options set the interpreter's limits and output, and the vm
+	// follows the same ones.
+	if r.vm != nil {
+		r.vm.stdout = r.interpreter.stdout
+		r.vm.limits = r.interpreter.limits
+		r.vm.gc.growth, r.vm.gc.stress = r.interpreter.gc.growth, r.interpreter.gc.stress
+		if r.trace != nil {
+			r.vm.trace = NewDisassembler(r.trace, "")
+		}
+	}
+
+	switch r.diagnostics {
+	case DiagnosticsJSON:
+		r.reporter = NewJSONReporter(r.stderr)
+	case DiagnosticsPlain:
+		r.reporter = NewPlainReporter(r.stderr)
+	default:
+		f, ok := r.stderr.(*os.File)
+		r.reporter = NewDiagnosticRenderer(r.stderr, ok && isTerminal(f))
 	}
+}
 
-	tokens, err := NewScanner(source).ScanTokens()
+// NewRuntime is New by the name the glox command has always used.
+func NewRuntime(opts ...RuntimeOption) *Runtime {
+	return New(opts...)
+}
+
+// Eval runs source and returns the value of its last statement when that's
+// an expression, and Nil otherwise. Problems found before running come back
+// as an ErrorList; nothing is reported on stderr, that's left to the caller.
+func (r *Runtime) Eval(ctx context.Context, source string) (Value, error) {
+	if r.vm != nil {
+		script, err := r.compileBytecode(source)
+		if err != nil {
+			return Nil, err
+		}
+		return r.vm.Interpret(ctx, script)
+	}
 
+	statements, err := r.compile(source, r.interpreter)
 	if err != nil {
+		return Nil, err
+	}
+	return r.interpreter.Evaluate(ctx, statements)
+}
+
+// Call calls the global function or class name with args, as if from Lox.
+func (r *Runtime) Call(name string, args ...Value) (Value, error) {
+	return r.CallContext(context.Background(), name, args...)
+}
+
+// CallContext is Call, stopped with ErrInterrupted if ctx is cancelled.
+func (r *Runtime) CallContext(ctx context.Context, name string, args ...Value) (Value, error) {
+	var callee Value
+	var ok bool
+	if r.vm != nil {
+		callee, ok = r.vm.globals[name]
+	} else {
+		callee, ok = r.interpreter.globals.values[name]
+	}
+	if !ok {
+		return Nil, fmt.Errorf("Undefined variable '%s'.", name)
+	}
+
+	arity, ok := r.arity(callee)
+	if !ok {
+		return Nil, fmt.Errorf("'%s' is not a function or class", name)
+	}
+	if len(args) != arity {
+		return Nil, fmt.Errorf("Expected %d arguments but got %d.", arity, len(args))
+	}
+
+	if r.vm != nil {
+		return r.vm.callContext(ctx, callee, args)
+	}
+	return r.interpreter.callContext(ctx, callee.object().(LoxCallable), args)
+}
+
+// Run evaluates source as the glox command does: any errors are reported on
+// stderr as diagnostics, then returned.
+func (r *Runtime) Run(source string, line int) error {
+	return r.RunContext(context.Background(), source, line)
+}
+
+// RunContext is Run, stopped with ErrInterrupted if ctx is cancelled.
+func (r *Runtime) RunContext(ctx context.Context, source string, line int) error {
+	r.source = source
+
+	_, err := r.Eval(ctx, source)
+	if list, ok := err.(ErrorList); ok {
+		r.reportErrors(list)
+	} else if err != nil {
+		if _, ok := err.(*runtimeError); !ok {
+			err = RuntimeError(line, err)
+		}
 		r.reportError(err)
-		return
+	}
+	return err
+}
+
+// DumpIR lowers source to the linear IR and writes it out to w without
+// running it. Problems with the source are reported on stderr and returned,
+// as Run does.
+//
+// The IR names every value: each instruction reads temporaries t0, t1, ...
+// and writes its result to another, and control flow is explicit jumps to
+// labels. Local variables are named after the source, with a suffix when one
+// shadows another, and globals are marked with @. --trace-exec shows the
+// bytecode the vm runs instead.
+func (r *Runtime) DumpIR(w io.Writer, source string) error {
+	r.source = source
+
+	statements, err := r.compile(source, NewInterpreter())
+	if list, ok := err.(ErrorList); ok {
+		r.reportErrors(list)
+		return err
+	}
+	NewDisassembler(w, source).ir(lowerIR(statements))
+	return nil
+}
+
+// compile scans, parses and resolves source ready to be interpreted by the
+// interpreter the resolver binds its variables in. The scanner leaves out
+// what it can't make sense of, so the tokens are still parsed after a
+// lexical error and any parse errors are reported along with it.
+func (r *Runtime) compile(source string, interpreter *interpreter) ([]Stmt, error) {
+	tokens, scanErrs := NewScanner(source).ScanTokens()
+
+	statements, errs := NewParser(tokens).parse()
+	if errs = append(scanErrs, errs...); len(errs) > 0 {
+		return nil, ErrorList(errs)
 	}
 
-	parser := NewParser(tokens)
-	exp := parser.parse()
-	interpreter := NewInterpreter()
-	err = interpreter.Interpret(exp)
+	if errs := NewResolver(interpreter).Resolve(statements); len(errs) > 0 {
+		return nil, ErrorList(errs)
+	}
+	return statements, nil
+}
 
+// compileBytecode compiles source for the vm. It still needs resolving, for
+// the errors the resolver finds, but the bindings are thrown away.
+func (r *Runtime) compileBytecode(source string) (*vmFunction, error) {
+	statements, err := r.compile(source, NewInterpreter())
 	if err != nil {
-		r.reportError(RuntimeError(line, err))
-		return
+		return nil, err
+	}
+
+	script, errs := NewCompiler().Compile(statements)
+	if len(errs) > 0 {
+		return nil, ErrorList(errs)
+	}
+	return script, nil
+}
+
+// GCStats reports what the garbage collector has done so far and how big the
+// heap is now.
+func (r *Runtime) GCStats() GCStats {
+	if r.vm != nil {
+		return r.vm.gc.statistics()
+	}
+	return r.interpreter.gc.statistics()
+}
+
+// CollectGarbage runs the garbage collector now rather than waiting for the
+// heap to grow. Between runs the only roots are the globals.
+func (r *Runtime) CollectGarbage() {
+	if r.vm != nil {
+		r.vm.gc.collect(r.vm)
+	} else {
+		r.interpreter.gc.collect(r.interpreter)
+	}
+}
+
+// arity is how many arguments callee takes, and false if it can't be called.
+func (r *Runtime) arity(callee Value) (int, bool) {
+	if r.vm != nil {
+		return arity(callee)
+	}
+	function, ok := callee.object().(LoxCallable)
+	if !ok {
+		return 0, false
+	}
+	return function.arity(), true
+}
+
+// define makes value a global in whichever engine the runtime uses.
+func (r *Runtime) define(name string, value Value) {
+	if r.vm != nil {
+		r.vm.globals[name] = value
+	} else {
+		r.interpreter.globals.define(name, value)
+	}
+}
+
+func (r *Runtime) reportErrors(errs []error) {
+	for _, e := range errs {
+		r.reportError(e)
 	}
 }
 
-func (r *loxRuntime) reportError(e error) {
-	fmt.Println(e)
-	r.HadError = true
+func (r *Runtime) reportError(e error) {
+	r.reporter.report(DiagnosticFor(e), r.fileName, r.source)
 }
@@ -1,12 +1,17 @@
 package glox
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
+	goruntime "runtime"
+	"strings"
 	"testing"
 )
 
 func TestRuntimeError(t *testing.T) {
-	expected := "[Line 2] Error0: this is a test string\n"
+	expected := "[Line 3] Error: this is a test string"
 	actual := RuntimeError(2, errors.New("this is a test string")).Error()
 
 	if actual != expected {
@@ -15,9 +20,166 @@ func TestRuntimeError(t *testing.T) {
 }
 
 func TestRuntimeRun(t *testing.T) {
-	runtime := NewRuntime()
-	runtime.Run(`"unterminated string`, 0)
-	if !runtime.HadError {
+	runtime := NewRuntime(WithStderr(io.Discard))
+	if err := runtime.Run(`"unterminated string`, 0); err == nil {
 		t.Errorf("Unterminated strings should be a runtime error")
 	}
 }
+
+func TestRuntimeRunParseErrorsDoNotPanic(t *testing.T) {
+	var stderr bytes.Buffer
+	runtime := NewRuntime(WithStderr(&stderr))
+	err := runtime.Run("print ;\nvar 1;", 0)
+
+	list, ok := err.(ErrorList)
+	if !ok || len(list) != 2 {
+		t.Fatalf("Expected both parse errors to be returned, got %v", err)
+	}
+	if strings.Count(stderr.String(), "error[") != 2 {
+		t.Errorf("Expected both parse errors to be reported, got:\n%s", stderr.String())
+	}
+}
+
+func TestRuntimeEval(t *testing.T) {
+	testcases := map[string]Value{
+		"1 + 2;":                   NumberValue(3),
+		`"con" + "cat";`:           StringValue("concat"),
+		"var a = 1;":               Nil,
+		"fun f() { return !nil; }": Nil,
+		"var b = false; b or nil;": Nil,
+		"!false;":                  BoolValue(true),
+	}
+
+	for source, expected := range testcases {
+		actual, err := New().Eval(context.Background(), source)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", source, err)
+		} else if actual != expected {
+			t.Errorf("%s: Expected: %v Actual: %v", source, expected, actual)
+		}
+	}
+}
+
+func TestRuntimeEvalKeepsGlobals(t *testing.T) {
+	runtime := New()
+	if _, err := runtime.Eval(context.Background(), "var greeting = \"hello\";"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	value, err := runtime.Eval(context.Background(), "greeting + \" world\";")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if s, _ := value.AsString(); s != "hello world" {
+		t.Errorf("Expected: hello world Actual: %v", value)
+	}
+}
+
+func TestRuntimeEvalMemoryStaysFlat(t *testing.T) {
+	runtime := New()
+	if _, err := runtime.Eval(context.Background(), "var y; fun add(a) { var b = a; { return a + b; } }"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	heapAfter := func(evals int) uint64 {
+		for n := 0; n < evals; n++ {
+			value, err := runtime.Eval(context.Background(), "{ var x = 1; y = x + add(x); } y;")
+			if err != nil || value != NumberValue(3) {
+				t.Fatalf("Expected 3, got %v, %v", value, err)
+			}
+		}
+		runtime.CollectGarbage()
+		goruntime.GC()
+		var stats goruntime.MemStats
+		goruntime.ReadMemStats(&stats)
+		return stats.HeapAlloc
+	}
+
+	before := heapAfter(10000)
+	if after := heapAfter(10000); after > before+256*1024 {
+		t.Errorf("Expected the heap to stay flat across Evals, grew from %d to %d bytes", before, after)
+	}
+	goruntime.KeepAlive(runtime)
+}
+
+func TestRuntimeEvalReturnsErrors(t *testing.T) {
+	var stderr bytes.Buffer
+	runtime := New(WithStderr(&stderr))
+
+	if _, err := runtime.Eval(context.Background(), "var;"); err == nil {
+		t.Errorf("Expected a parse error")
+	}
+	if _, err := runtime.Eval(context.Background(), "-\"a\";"); err == nil {
+		t.Errorf("Expected a runtime error")
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("Eval should leave reporting to the caller, but wrote:\n%s", stderr.String())
+	}
+}
+
+func TestRuntimeEvalStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := New().Eval(ctx, "print 1;"); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Expected ErrInterrupted, got %v", err)
+	}
+}
+
+func TestRuntimeCall(t *testing.T) {
+	runtime := New()
+	_, err := runtime.Eval(context.Background(), `
+	fun add(a, b) { return a + b; }
+	class Point { init(x) { this.x = x; } }
+	var notAFunction = 1;
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	sum, err := runtime.Call("add", NumberValue(1), NumberValue(2))
+	if n, _ := sum.AsNumber(); err != nil || n != 3 {
+		t.Errorf("Expected add(1, 2) to be 3, got %v, %v", sum, err)
+	}
+
+	point, err := runtime.Call("Point", NumberValue(1))
+	if err != nil || point.Kind() != InstanceKind {
+		t.Errorf("Expected calling a class to make an instance, got %v, %v", point, err)
+	}
+
+	for name, args := range map[string][]Value{
+		"missing":      nil,
+		"notAFunction": nil,
+		"add":          {NumberValue(1)},
+	} {
+		if _, err := runtime.Call(name, args...); err == nil {
+			t.Errorf("Expected calling %s with %v to fail", name, args)
+		}
+	}
+
+	if _, err := runtime.Call("add", NumberValue(1), BoolValue(true)); err == nil {
+		t.Errorf("Expected a runtime error from inside add")
+	}
+}
+
+func TestRuntimeWritesPrintToStdout(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := New(WithStdout(&stdout)).Run("print 1; print \"two\";", 0); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if stdout.String() != "1\ntwo\n" {
+		t.Errorf("Expected: %q Actual: %q", "1\ntwo\n", stdout.String())
+	}
+}
+
+func TestRuntimeErrorsCarryTokenSpans(t *testing.T) {
+	_, err := interpretedSource("var a = 1;\nprint a + \"one\";")
+
+	rtErr, ok := err.(*runtimeError)
+	if !ok {
+		t.Fatalf("Expected a runtimeError, got %v", err)
+	}
+	if rtErr.line != 1 || rtErr.span.String() != "1:8-1:9" {
+		t.Errorf("Expected error at the '+' on line 1, got line %d span %v", rtErr.line, rtErr.span)
+	}
+}
@@ -7,12 +7,16 @@ import (
 )
 
 type scanner struct {
-	source    string
-	tokenList []*Token
-	keywords  map[string]TokenType
-	start     int
-	current   int
-	line      int
+	source      string
+	tokenList   []*Token
+	errors      []error
+	keywords    map[string]TokenType
+	start       int
+	current     int
+	line        int
+	lineStart   int
+	startLine   int
+	startColumn int
 }
 
 func NewScanner(source string) *scanner {
@@ -43,21 +47,24 @@ func NewScanner(source string) *scanner {
 	}
 }
 
-func (s *scanner) ScanTokens() ([]*Token, error) {
+// ScanTokens scans the whole source, skipping over anything it can't make
+// sense of so that every lexical error in the file is reported at once.
+func (s *scanner) ScanTokens() ([]*Token, []error) {
 	for !s.isAtEnd() {
 		s.start = s.current
-		err := s.scanToken()
-		if err != nil {
-			return nil, err
+		s.startLine = s.line
+		s.startColumn = s.current - s.lineStart
+		if err := s.scanToken(); err != nil {
+			s.errors = append(s.errors, err)
 		}
 	}
 
 	s.tokenList = append(
 		s.tokenList,
-		NewToken(EOF, "", nil, s.line),
+		NewTokenAt(EOF, "", nil, s.line, s.current, s.current-s.lineStart),
 	)
 
-	return s.tokenList, nil
+	return s.tokenList, s.errors
 }
 
 func (s *scanner) scanToken() error {
@@ -142,7 +149,7 @@ func (s *scanner) scanToken() error {
 	case ' ', '\r', '\t':
 		return nil
 	case '\n':
-		s.line += 1
+		s.newline()
 		return nil
 	case '"':
 		return s.stringLiteral()
@@ -153,7 +160,7 @@ func (s *scanner) scanToken() error {
 			s.identifier()
 			return nil
 		} else {
-			return RuntimeError(s.line, errors.New("unexpected character"))
+			return s.error(errors.New("Unexpected character."))
 		}
 	}
 }
@@ -161,13 +168,17 @@ func (s *scanner) scanToken() error {
 func (s *scanner) stringLiteral() error {
 	for s.peek() != '"' && !s.isAtEnd() {
 		if s.peek() == '\n' {
-			s.line += 1
+			s.advance()
+			s.newline()
+			continue
 		}
 		s.advance()
 	}
 
 	if s.isAtEnd() {
-		return RuntimeError(s.line, errors.New("unterminated string"))
+		err := s.error(errors.New("Unterminated string."))
+		err.hint = `add a closing '"' to end the string`
+		return err
 	}
 
 	s.advance() // This is the closing '"'
@@ -192,7 +203,7 @@ func (s *scanner) numberLiteral() error {
 		s.addToken(NUMBER, numLiteral)
 		return nil
 	} else {
-		return err
+		return s.error(err)
 	}
 }
 
@@ -216,7 +227,7 @@ func (s *scanner) cStyleComment() {
 		c := s.advance()
 		switch c {
 		case '\n':
-			s.line += 1
+			s.newline()
 		case '/':
 			if s.match('*') {
 				s.cStyleComment()
@@ -231,6 +242,19 @@ func (s *scanner) cStyleComment() {
 	}
 }
 
+func (s *scanner) newline() {
+	s.line += 1
+	s.lineStart = s.current
+}
+
+// error reports a problem with the token being scanned, spanning from where
+// the token started to where the scanner gave up on it.
+func (s *scanner) error(err error) *scanError {
+	start := Position{Offset: s.start, Line: s.startLine, Column: s.startColumn}
+	end := Position{Offset: s.current, Line: s.line, Column: s.current - s.lineStart}
+	return ScanError(Span{start, end}, err)
+}
+
 func (s *scanner) advance() byte {
 	character := s.source[s.current]
 	s.current += 1
@@ -268,7 +292,7 @@ func (s *scanner) isAtEnd() bool {
 
 func (s *scanner) addToken(tt TokenType, literal interface{}) {
 	text := s.source[s.start:s.current]
-	token := NewToken(tt, text, literal, s.line)
+	token := NewTokenAt(tt, text, literal, s.startLine, s.start, s.startColumn)
 	s.tokenList = append(s.tokenList, token)
 }
 
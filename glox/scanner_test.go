@@ -167,11 +167,97 @@ func TestUnfinishedCStyleComment(t *testing.T) {
 	compareTokensInOrder(tokenList, expectedToken, t)
 }
 
+func TestScannerContinuesPastErrors(t *testing.T) {
+	source := "var a = 1 @ 2;\n  # print \"oops"
+	tokenList, errs := NewScanner(source).ScanTokens()
+
+	expectedErrors := []string{
+		"[Line 1] Error at column 11: Unexpected character.",
+		"[Line 2] Error at column 3: Unexpected character.",
+		"[Line 2] Error at column 11: Unterminated string.",
+	}
+	if len(errs) != len(expectedErrors) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expectedErrors), len(errs), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expectedErrors[i] {
+			t.Errorf("Expected: %s Actual: %s", expectedErrors[i], err.Error())
+		}
+	}
+
+	expectedTokens := []*Token{
+		NewToken(VAR, "var", nil, 0),
+		NewToken(IDENTIFIER, "a", nil, 0),
+		NewToken(EQUAL, "=", nil, 0),
+		NewToken(NUMBER, "1", 1.0, 0),
+		NewToken(NUMBER, "2", 2.0, 0),
+		NewToken(SEMICOLON, ";", nil, 0),
+		NewToken(PRINT, "print", nil, 1),
+		NewToken(EOF, "", nil, 1),
+	}
+	compareTokensInOrder(tokenList, expectedTokens, t)
+}
+
+func TestScannerErrorColumnAfterMultilineString(t *testing.T) {
+	_, errs := NewScanner("\"one\ntwo\" ~").ScanTokens()
+
+	expected := "[Line 2] Error at column 6: Unexpected character."
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("Expected: %s Actual: %v", expected, errs)
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	source := "var a = \"x\";\n  print a;"
+	tokenList := scanSource(source, t)
+
+	expected := []struct {
+		lexeme         string
+		offset, column int
+	}{
+		{"var", 0, 0},
+		{"a", 4, 4},
+		{"=", 6, 6},
+		{`"x"`, 8, 8},
+		{";", 11, 11},
+		{"print", 15, 2},
+		{"a", 21, 8},
+		{";", 22, 9},
+		{"", 23, 10},
+	}
+	if len(tokenList) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d", len(expected), len(tokenList))
+	}
+	for i, token := range tokenList {
+		if token.lexeme != expected[i].lexeme || token.offset != expected[i].offset ||
+			token.column != expected[i].column || token.length != len(expected[i].lexeme) {
+			t.Errorf(
+				"Token %d position incorrect.\n\nExpected: %q at offset %d column %d\nGot: %q at offset %d column %d length %d",
+				i, expected[i].lexeme, expected[i].offset, expected[i].column,
+				token.lexeme, token.offset, token.column, token.length,
+			)
+		}
+	}
+}
+
+func TestMultilineStringStartsOnItsFirstLine(t *testing.T) {
+	tokenList := scanSource("\n  \"one\ntwo\"", t)
+
+	str := tokenList[0]
+	if str.line != 1 || str.column != 2 {
+		t.Errorf("Expected string to start at 1:2, got %d:%d", str.line, str.column)
+	}
+	expected := Span{Position{3, 1, 2}, Position{12, 2, 4}}
+	if str.Span() != expected {
+		t.Errorf("Expected: %v Actual: %v", expected, str.Span())
+	}
+}
+
 func scanSource(source string, t *testing.T) []*Token {
 	scanner := NewScanner(source)
-	tokenList, err := scanner.ScanTokens()
-	if err != nil {
-		t.Errorf("ScanTokens returned an error")
+	tokenList, errs := scanner.ScanTokens()
+	if len(errs) > 0 {
+		t.Errorf("ScanTokens returned errors: %v", errs)
 	}
 
 	return tokenList
@@ -193,7 +279,10 @@ func compareTokensInOrder(tokenList []*Token, expectedTokens []*Token, t *testin
 	}
 
 	for i, token := range tokenList {
-		if *token != *expectedTokens[i] {
+		// Expected tokens are built without positions, which get their own tests.
+		expected := expectedTokens[i]
+		if token.tokenType != expected.tokenType || token.lexeme != expected.lexeme ||
+			token.literal != expected.literal || token.line != expected.line {
 			expectedToken := expectedTokens[i]
 			t.Errorf(
 				"Token does not match expected.\n\nExpected: %v line %d\nGot %v line %d",
@@ -0,0 +1,40 @@
+package glox
+
+import "fmt"
+
+// Position is a location in the source. Lines and columns count from zero;
+// diagnostics and error messages show them counting from one.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Span covers the source from Start up to, but not including, End.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%d:%d-%d:%d", s.Start.Line, s.Start.Column, s.End.Line, s.End.Column)
+}
+
+// Node is implemented by every Expr and Stmt. The parser records the span of
+// the tokens each node was built from.
+type Node interface {
+	Span() Span
+	setSpan(Span)
+}
+
+type node struct {
+	span Span
+}
+
+func (n *node) Span() Span {
+	return n.span
+}
+
+func (n *node) setSpan(span Span) {
+	n.span = span
+}
@@ -0,0 +1,68 @@
+package glox
+
+import "fmt"
+
+// scriptFrameName names the outermost frame, the top level of the script.
+const scriptFrameName = "<script>"
+
+// maxTraceFrames is how many of the innermost frames are kept in a trace, so
+// a stack overflow doesn't print thousands of them.
+const maxTraceFrames = 32
+
+// StackFrame is one line of a Lox stack trace: the function that was running
+// and how far it had got.
+type StackFrame struct {
+	Function string
+	Position Position
+}
+
+// format describes the frame with a one-based line and column, like the
+// location in a rendered diagnostic.
+func (f StackFrame) format(fileName string) string {
+	location := fmt.Sprintf("%d:%d", f.Position.Line+1, f.Position.Column+1)
+	if fileName != "" {
+		location = fileName + ":" + location
+	}
+	return fmt.Sprintf("at %s (%s)", f.Function, location)
+}
+
+type callFrame struct {
+	function string
+	callSite Position
+}
+
+func callableName(callable LoxCallable) string {
+	switch c := callable.(type) {
+	case *loxFunction:
+		return c.declaration.Name.lexeme
+	case *loxClass:
+		return c.name
+	case *nativeFunction:
+		return c.name
+	default:
+		return fmt.Sprintf("%v", callable)
+	}
+}
+
+// stackTrace lists the frames on the interpreter's call stack, innermost
+// first. The innermost frame is positioned where the error happened and every
+// other frame where it made the call that's still running.
+func (i *interpreter) stackTrace(at Position) []StackFrame {
+	trace := make([]StackFrame, 0, len(i.callStack)+1)
+	for idx := len(i.callStack) - 1; idx >= 0; idx-- {
+		frame := i.callStack[idx]
+		trace = append(trace, StackFrame{frame.function, at})
+		at = frame.callSite
+	}
+	return append(trace, StackFrame{scriptFrameName, at})
+}
+
+// attachTrace gives err the trace, keeping only the innermost frames of a
+// long one.
+func attachTrace(err *runtimeError, trace []StackFrame) {
+	err.trace = trace
+	if omitted := len(trace) - maxTraceFrames; omitted > 0 {
+		err.trace = trace[:maxTraceFrames]
+		err.note = fmt.Sprintf("%d more frames not shown", omitted)
+	}
+}
@@ -0,0 +1,96 @@
+package glox
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	_, err := interpretedSource(`fun inner(x) {
+  return x + "a";
+}
+fun outer() {
+  return inner(1);
+}
+outer();`)
+
+	rtErr, ok := err.(*runtimeError)
+	if !ok {
+		t.Fatalf("Expected a runtimeError, got %v", err)
+	}
+
+	expected := []string{
+		"at inner (script.lox:2:12)",
+		"at outer (script.lox:5:10)",
+		"at <script> (script.lox:7:1)",
+	}
+	if len(rtErr.trace) != len(expected) {
+		t.Fatalf("Expected %d frames, got %v", len(expected), rtErr.trace)
+	}
+	for i, frame := range rtErr.trace {
+		if actual := frame.format("script.lox"); actual != expected[i] {
+			t.Errorf("Frame %d incorrect.\n\nExpected: %s\nGot: %s", i, expected[i], actual)
+		}
+	}
+}
+
+func TestTopLevelRuntimeErrorHasNoTrace(t *testing.T) {
+	_, err := interpretedSource(`-"a";`)
+
+	if rtErr, ok := err.(*runtimeError); !ok || rtErr.trace != nil {
+		t.Errorf("Expected a runtimeError without a trace, got %#v", err)
+	}
+}
+
+func TestCallStackUnwindsAfterErrors(t *testing.T) {
+	interpreter, err := interpretedSource(`fun fail() { return nil + 1; }
+fail();`)
+	if err == nil {
+		t.Fatalf("Expected the call to fail")
+	}
+	if len(interpreter.callStack) != 0 {
+		t.Errorf("Expected the call stack to be empty, got %v", interpreter.callStack)
+	}
+}
+
+func TestNativeErrorsAreLocatedAtTheCall(t *testing.T) {
+	interpreter := NewInterpreter()
+	interpreter.globals.define("explode", functionValue(&nativeFunction{
+		name:       "explode",
+		arityValue: 0,
+		fn: func(arguments []Value) (Value, error) {
+			return Nil, errors.New("boom")
+		},
+	}))
+	tokens, _ := NewScanner("\n  explode();").ScanTokens()
+	statements, _ := NewParser(tokens).parse()
+
+	err := interpreter.Interpret(statements)
+	rtErr, ok := err.(*runtimeError)
+	if !ok {
+		t.Fatalf("Expected the native's error to become a runtimeError, got %v", err)
+	}
+	if rtErr.line != 1 || len(rtErr.trace) != 2 || rtErr.trace[0].Function != "explode" {
+		t.Errorf("Expected the error on line 1 inside 'explode', got line %d trace %v", rtErr.line, rtErr.trace)
+	}
+}
+
+func TestRenderStackTrace(t *testing.T) {
+	source := "fun f() {\n  return -nil;\n}\nf();"
+	_, err := interpretedSource(source)
+
+	buf := bytes.Buffer{}
+	NewDiagnosticRenderer(&buf, false).report(DiagnosticFor(err), "script.lox", source)
+
+	expected := strings.Join([]string{
+		"  = stack trace:",
+		"      at f (script.lox:2:10)",
+		"      at <script> (script.lox:4:1)",
+		"",
+	}, "\n")
+	if !strings.HasSuffix(buf.String(), expected) {
+		t.Errorf("Expected the trace at the end of the diagnostic.\n\nExpected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,144 @@
+package glox
+
+type Stmt interface {
+	Node
+	Accept(VisitorStmt) (interface{}, error)
+}
+
+type VisitorStmt interface {
+	visitExpressionStmt(*Expression) (interface{}, error)
+	visitPrintStmt(*Print) (interface{}, error)
+	visitVarStmt(*Var) (interface{}, error)
+	visitBlockStmt(*Block) (interface{}, error)
+	visitIfStmt(*If) (interface{}, error)
+	visitWhileStmt(*While) (interface{}, error)
+	visitFunctionStmt(*Function) (interface{}, error)
+	visitReturnStmt(*Return) (interface{}, error)
+	visitClassStmt(*Class) (interface{}, error)
+}
+
+type Expression struct {
+	node
+	Expression Expr
+}
+
+func NewExpression(expression Expr) Stmt {
+	return &Expression{Expression: expression}
+}
+
+func (e *Expression) Accept(visitor VisitorStmt) (interface{}, error) {
+	return visitor.visitExpressionStmt(e)
+}
+
+type Print struct {
+	node
+	Expression Expr
+}
+
+func NewPrint(expression Expr) Stmt {
+	return &Print{Expression: expression}
+}
+
+func (p *Print) Accept(visitor VisitorStmt) (interface{}, error) {
+	return visitor.visitPrintStmt(p)
+}
+
+type Var struct {
+	node
+	Name        *Token
+	Initializer Expr
+}
+
+func NewVar(name *Token, initializer Expr) Stmt {
+	return &Var{Name: name, Initializer: initializer}
+}
+
+func (v *Var) Accept(visitor VisitorStmt) (interface{}, error) {
+	return visitor.visitVarStmt(v)
+}
+
+type Block struct {
+	node
+	Statements []Stmt
+}
+
+func NewBlock(statements []Stmt) Stmt {
+	return &Block{Statements: statements}
+}
+
+func (b *Block) Accept(visitor VisitorStmt) (interface{}, error) {
+	return visitor.visitBlockStmt(b)
+}
+
+type If struct {
+	node
+	Condition  Expr
+	ThenBranch Stmt
+	ElseBranch Stmt
+}
+
+func NewIf(condition Expr, thenBranch Stmt, elseBranch Stmt) Stmt {
+	return &If{Condition: condition, ThenBranch: thenBranch, ElseBranch: elseBranch}
+}
+
+func (i *If) Accept(visitor VisitorStmt) (interface{}, error) {
+	return visitor.visitIfStmt(i)
+}
+
+type While struct {
+	node
+	Condition Expr
+	Body      Stmt
+}
+
+func NewWhile(condition Expr, body Stmt) Stmt {
+	return &While{Condition: condition, Body: body}
+}
+
+func (w *While) Accept(visitor VisitorStmt) (interface{}, error) {
+	return visitor.visitWhileStmt(w)
+}
+
+type Function struct {
+	node
+	Name   *Token
+	Params []*Token
+	Body   []Stmt
+}
+
+func NewFunction(name *Token, params []*Token, body []Stmt) Stmt {
+	return &Function{Name: name, Params: params, Body: body}
+}
+
+func (f *Function) Accept(visitor VisitorStmt) (interface{}, error) {
+	return visitor.visitFunctionStmt(f)
+}
+
+type Return struct {
+	node
+	Keyword *Token
+	Value   Expr
+}
+
+func NewReturn(keyword *Token, value Expr) Stmt {
+	return &Return{Keyword: keyword, Value: value}
+}
+
+func (r *Return) Accept(visitor VisitorStmt) (interface{}, error) {
+	return visitor.visitReturnStmt(r)
+}
+
+type Class struct {
+	node
+	Name       *Token
+	Superclass *Variable
+	Methods    []*Function
+}
+
+func NewClass(name *Token, superclass *Variable, methods []*Function) Stmt {
+	return &Class{Name: name, Superclass: superclass, Methods: methods}
+}
+
+func (c *Class) Accept(visitor VisitorStmt) (interface{}, error) {
+	return visitor.visitClassStmt(c)
+}
@@ -66,6 +66,9 @@ type Token struct {
 	lexeme    string
 	literal   interface{}
 	line      int
+	offset    int
+	column    int
+	length    int
 }
 
 func NewToken(tt TokenType, lexeme string, lit interface{}, line int) *Token {
@@ -74,9 +77,33 @@ func NewToken(tt TokenType, lexeme string, lit interface{}, line int) *Token {
 		lexeme:    lexeme,
 		literal:   lit,
 		line:      line,
+		length:    len(lexeme),
 	}
 }
 
+// NewTokenAt creates a token that knows exactly where in the source it came
+// from: the byte offset and column of its first character.
+func NewTokenAt(tt TokenType, lexeme string, lit interface{}, line, offset, column int) *Token {
+	token := NewToken(tt, lexeme, lit, line)
+	token.offset = offset
+	token.column = column
+	return token
+}
+
+// Span covers the token's lexeme, which for strings may run over several
+// lines.
+func (t *Token) Span() Span {
+	start := Position{Offset: t.offset, Line: t.line, Column: t.column}
+	end := Position{Offset: t.offset + t.length, Line: t.line, Column: t.column + t.length}
+
+	if newline := strings.LastIndexByte(t.lexeme, '\n'); newline >= 0 {
+		end.Line += strings.Count(t.lexeme, "\n")
+		end.Column = t.length - newline - 1
+	}
+
+	return Span{start, end}
+}
+
 func (t *Token) String() string {
 	var literal interface{}
 
@@ -0,0 +1,273 @@
+package glox
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Kind says which sort of Lox value a Value holds.
+type Kind int
+
+const (
+	NilKind Kind = iota
+	BoolKind
+	NumberKind
+	StringKind
+	FunctionKind
+	ClassKind
+	InstanceKind
+	HostKind
+)
+
+func (k Kind) String() string {
+	switch k {
+	case BoolKind:
+		return "boolean"
+	case NumberKind:
+		return "number"
+	case StringKind:
+		return "string"
+	case FunctionKind:
+		return "function"
+	case ClassKind:
+		return "class"
+	case InstanceKind:
+		return "instance"
+	case HostKind:
+		return "host object"
+	default:
+		return "nil"
+	}
+}
+
+// Value is a Lox value, as the engines hold it and as it goes into and out
+// of a script. It's a tagged union: the kind says which field is in use, so
+// telling numbers from strings and doing arithmetic needs no type assertions
+// and nothing is boxed on the heap. The zero Value is Lox's nil.
+type Value struct {
+	kind Kind
+	// n holds numbers, and booleans as 0 or 1.
+	n float64
+	// ref holds strings, and a pointer to the object for every other kind.
+	ref interface{}
+}
+
+// Nil is Lox's nil.
+var Nil = Value{}
+
+var (
+	trueValue  = Value{kind: BoolKind, n: 1}
+	falseValue = Value{kind: BoolKind}
+)
+
+func BoolValue(b bool) Value {
+	if b {
+		return trueValue
+	}
+	return falseValue
+}
+
+func NumberValue(n float64) Value {
+	return Value{kind: NumberKind, n: n}
+}
+
+func StringValue(s string) Value {
+	return Value{kind: StringKind, ref: s}
+}
+
+func functionValue(f interface{}) Value {
+	return Value{kind: FunctionKind, ref: f}
+}
+
+func classValue(c interface{}) Value {
+	return Value{kind: ClassKind, ref: c}
+}
+
+func instanceValue(i interface{}) Value {
+	return Value{kind: InstanceKind, ref: i}
+}
+
+// ValueOf converts a Go nil, bool, string or number, or any type based on
+// one, into a Value. Lox only has one kind of number, so every integer and
+// float type becomes a float64. A pointer to a struct becomes an object whose
+// fields and methods scripts can use, sharing the struct with the host.
+func ValueOf(x interface{}) (Value, error) {
+	if v, ok := valueOf(x); ok {
+		return v, nil
+	}
+
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NumberValue(float64(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NumberValue(float64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return NumberValue(rv.Float()), nil
+	case reflect.Bool:
+		return BoolValue(rv.Bool()), nil
+	case reflect.String:
+		return StringValue(rv.String()), nil
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return Nil, nil
+		}
+		if rv.Elem().Kind() == reflect.Struct {
+			return Value{kind: HostKind, ref: newHostObject(rv)}, nil
+		}
+		return Nil, fmt.Errorf("can't convert Go %T to a Lox value", x)
+	default:
+		return Nil, fmt.Errorf("can't convert Go %T to a Lox value", x)
+	}
+}
+
+// valueOf converts the types Lox values are made of, like literals from the
+// scanner, without reflection. It's false for anything else.
+func valueOf(x interface{}) (Value, bool) {
+	switch x := x.(type) {
+	case nil:
+		return Nil, true
+	case Value:
+		return x, true
+	case bool:
+		return BoolValue(x), true
+	case float64:
+		return NumberValue(x), true
+	case string:
+		return StringValue(x), true
+	case *loxFunction, *nativeFunction, *closure, *boundMethod:
+		return functionValue(x), true
+	case *loxClass, *vmClass:
+		return classValue(x), true
+	case *loxInstance, *vmInstance:
+		return instanceValue(x), true
+	case *hostObject:
+		return Value{kind: HostKind, ref: x}, true
+	default:
+		return Nil, false
+	}
+}
+
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+func (v Value) IsNil() bool {
+	return v.kind == NilKind
+}
+
+func (v Value) IsBool() bool {
+	return v.kind == BoolKind
+}
+
+func (v Value) IsNumber() bool {
+	return v.kind == NumberKind
+}
+
+func (v Value) IsString() bool {
+	return v.kind == StringKind
+}
+
+// Truthy follows Lox's rules: nil and false are false, everything else true.
+func (v Value) Truthy() bool {
+	switch v.kind {
+	case NilKind:
+		return false
+	case BoolKind:
+		return v.n != 0
+	default:
+		return true
+	}
+}
+
+// Equal is Lox's ==. Numbers, strings and booleans are equal when their
+// values are; objects only when they're the same object.
+func (v Value) Equal(other Value) bool {
+	if v.kind != other.kind {
+		return false
+	}
+	switch v.kind {
+	case NilKind:
+		return true
+	case BoolKind, NumberKind:
+		return v.n == other.n
+	case HostKind:
+		return v.ref.(*hostObject).same(other.ref.(*hostObject))
+	default:
+		return v.ref == other.ref
+	}
+}
+
+func (v Value) AsBool() (bool, error) {
+	if v.kind != BoolKind {
+		return false, v.conversionError(BoolKind)
+	}
+	return v.n != 0, nil
+}
+
+func (v Value) AsNumber() (float64, error) {
+	if v.kind != NumberKind {
+		return 0, v.conversionError(NumberKind)
+	}
+	return v.n, nil
+}
+
+func (v Value) AsString() (string, error) {
+	if v.kind != StringKind {
+		return "", v.conversionError(StringKind)
+	}
+	return v.ref.(string), nil
+}
+
+// Interface returns the value as a plain Go value: nil, bool, float64 or
+// string for the simple kinds. Host objects give back the Go pointer they
+// were made from, and other objects the engine's own representation of them.
+func (v Value) Interface() interface{} {
+	switch v.kind {
+	case NilKind:
+		return nil
+	case BoolKind:
+		return v.n != 0
+	case NumberKind:
+		return v.n
+	case HostKind:
+		return v.ref.(*hostObject).value.Interface()
+	default:
+		return v.ref
+	}
+}
+
+// String is the value as Lox would print it.
+func (v Value) String() string {
+	switch v.kind {
+	case NilKind:
+		return "nil"
+	case BoolKind:
+		return strconv.FormatBool(v.n != 0)
+	case NumberKind:
+		return strconv.FormatFloat(v.n, 'g', -1, 64)
+	case StringKind:
+		return v.ref.(string)
+	default:
+		return v.ref.(fmt.Stringer).String()
+	}
+}
+
+// number, str and object read a Value the caller already knows the kind of.
+
+func (v Value) number() float64 {
+	return v.n
+}
+
+func (v Value) str() string {
+	return v.ref.(string)
+}
+
+func (v Value) object() interface{} {
+	return v.ref
+}
+
+func (v Value) conversionError(want Kind) error {
+	return fmt.Errorf("value is a %s, not a %s", v.Kind(), want)
+}
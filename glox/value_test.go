@@ -0,0 +1,139 @@
+package glox
+
+import (
+	"context"
+	"testing"
+)
+
+func TestValueOf(t *testing.T) {
+	testcases := []struct {
+		in       interface{}
+		expected Value
+	}{
+		{nil, Nil},
+		{true, BoolValue(true)},
+		{"text", StringValue("text")},
+		{1.5, NumberValue(1.5)},
+		{float32(0.5), NumberValue(0.5)},
+		{42, NumberValue(42)},
+		{int8(-3), NumberValue(-3)},
+		{uint64(7), NumberValue(7)},
+		{StringValue("already"), StringValue("already")},
+	}
+
+	for _, tc := range testcases {
+		actual, err := ValueOf(tc.in)
+		if err != nil {
+			t.Errorf("%#v: unexpected error %v", tc.in, err)
+		} else if actual != tc.expected {
+			t.Errorf("%#v: Expected: %v Actual: %v", tc.in, tc.expected, actual)
+		}
+	}
+
+	if _, err := ValueOf([]int{1}); err == nil {
+		t.Errorf("Expected slices to be rejected")
+	}
+}
+
+func TestValueConversions(t *testing.T) {
+	if n, err := NumberValue(2).AsNumber(); err != nil || n != 2 {
+		t.Errorf("Expected 2, got %v, %v", n, err)
+	}
+	if s, err := StringValue("s").AsString(); err != nil || s != "s" {
+		t.Errorf("Expected s, got %v, %v", s, err)
+	}
+	if b, err := BoolValue(true).AsBool(); err != nil || !b {
+		t.Errorf("Expected true, got %v, %v", b, err)
+	}
+
+	_, err := StringValue("1").AsNumber()
+	if err == nil || err.Error() != "value is a string, not a number" {
+		t.Errorf("Expected a conversion error, got %v", err)
+	}
+}
+
+func TestValueKindAndString(t *testing.T) {
+	testcases := []struct {
+		value  Value
+		kind   Kind
+		str    string
+		truthy bool
+	}{
+		{Nil, NilKind, "nil", false},
+		{BoolValue(false), BoolKind, "false", false},
+		{NumberValue(0), NumberKind, "0", true},
+		{StringValue(""), StringKind, "", true},
+		{functionValue(clockNative()), FunctionKind, "<native fn>", true},
+		{classValue(NewLoxClass("Bagel", nil, nil)), ClassKind, "Bagel", true},
+	}
+
+	for _, tc := range testcases {
+		if tc.value.Kind() != tc.kind {
+			t.Errorf("%v: Expected kind %v, got %v", tc.value, tc.kind, tc.value.Kind())
+		}
+		if tc.value.String() != tc.str {
+			t.Errorf("Expected: %q Actual: %q", tc.str, tc.value.String())
+		}
+		if tc.value.Truthy() != tc.truthy {
+			t.Errorf("%v: Expected truthiness %v", tc.value, tc.truthy)
+		}
+	}
+}
+
+func TestValueEqual(t *testing.T) {
+	class := NewLoxClass("Bagel", nil, nil)
+	instance := NewLoxInstance(class)
+
+	testcases := []struct {
+		a, b     Value
+		expected bool
+	}{
+		{Nil, Nil, true},
+		{Nil, BoolValue(false), false},
+		{NumberValue(1), NumberValue(1), true},
+		{NumberValue(0), BoolValue(false), false},
+		{StringValue("1"), NumberValue(1), false},
+		{StringValue("a" + "b"), StringValue("ab"), true},
+		{instanceValue(instance), instanceValue(instance), true},
+		{instanceValue(instance), instanceValue(NewLoxInstance(class)), false},
+		{classValue(class), classValue(NewLoxClass("Bagel", nil, nil)), false},
+	}
+
+	for _, tc := range testcases {
+		if tc.a.Equal(tc.b) != tc.expected {
+			t.Errorf("%v == %v: Expected %v", tc.a, tc.b, tc.expected)
+		}
+	}
+}
+
+func TestInstancesEqualByIdentity(t *testing.T) {
+	source := `class Foo {} var f = Foo(); print Foo() == Foo(); print f == f; print Foo == Foo;`
+	expected := "false\ntrue\ntrue\n"
+
+	tree, vm := runBoth(source)
+	if tree != expected || vm != expected {
+		t.Errorf("Expected:\n%s\nTree:\n%s\nVM:\n%s", expected, tree, vm)
+	}
+}
+
+// The loops below are mostly number crunching, which is where boxing every
+// number into an interface used to cost the most.
+var arithmeticBenchmarks = map[string]string{
+	"Sum": `var sum = 0; for (var i = 0; i < 100000; i = i + 1) { sum = sum + i * 2 - 1; }`,
+	"Fib": `fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); } fib(20);`,
+}
+
+func benchmarkArithmetic(b *testing.B, engine Engine, name string) {
+	source := arithmeticBenchmarks[name]
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := New(WithEngine(engine)).Eval(context.Background(), source); err != nil {
+			b.Fatalf("Unexpected error %v", err)
+		}
+	}
+}
+
+func BenchmarkTreeSum(b *testing.B) { benchmarkArithmetic(b, EngineTree, "Sum") }
+func BenchmarkTreeFib(b *testing.B) { benchmarkArithmetic(b, EngineTree, "Fib") }
+func BenchmarkVMSum(b *testing.B)   { benchmarkArithmetic(b, EngineVM, "Sum") }
+func BenchmarkVMFib(b *testing.B)   { benchmarkArithmetic(b, EngineVM, "Fib") }
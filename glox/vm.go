@@ -0,0 +1,580 @@
+package glox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// frame is a call in progress on the vm: the closure being run, how far
+// through its code it's got, and where its slots start on the stack. Slot
+// zero holds the callee, or the receiver for methods.
+type frame struct {
+	closure *closure
+	ip      int
+	base    int
+	name    string
+}
+
+// span is where in the source the instruction the frame last read came from.
+func (f *frame) span() Span {
+	return f.closure.function.chunk.spans[f.ip-1]
+}
+
+// vm runs the bytecode the compiler produces. It behaves the same as the
+// tree-walking interpreter, down to the wording of its errors.
+type vm struct {
+	stack        []Value
+	frames       []*frame
+	globals      map[string]Value
+	openUpvalues []*upvalue
+	stdout       io.Writer
+	trace        *disassembler
+	gc           collector
+	limits
+}
+
+func NewVM() *vm {
+	return &vm{
+		stack:   make([]Value, 0, 256),
+		globals: map[string]Value{"clock": functionValue(clockNative())},
+		stdout:  os.Stdout,
+		gc:      newCollector(),
+		limits:  newLimits(),
+	}
+}
+
+// Interpret runs a compiled script and returns what it returned. Cancelling
+// ctx stops it with ErrInterrupted at the next loop iteration or call.
+func (vm *vm) Interpret(ctx context.Context, script *vmFunction) (result Value, err error) {
+	defer vm.limitTo(ctx)()
+	defer vm.unwindOnError(&err, len(vm.stack), len(vm.frames))
+
+	// The script gets its frame directly rather than through call, which
+	// would count it as a step and against the call depth.
+	closure := &closure{function: script}
+	vm.gc.track(closure)
+	vm.push(functionValue(closure))
+	vm.frames = append(vm.frames, &frame{closure: closure, base: len(vm.stack) - 1})
+	return vm.run(len(vm.frames) - 1)
+}
+
+// callContext calls callee with arguments from Go, limited by ctx as
+// Interpret is, and runs it until it returns.
+func (vm *vm) callContext(ctx context.Context, callee Value, arguments []Value) (result Value, err error) {
+	defer vm.limitTo(ctx)()
+	frameCount := len(vm.frames)
+	defer vm.unwindOnError(&err, len(vm.stack), frameCount)
+
+	vm.push(callee)
+	for _, argument := range arguments {
+		vm.push(argument)
+	}
+	if err := vm.callValue(callee, len(arguments), Span{}); err != nil {
+		return Nil, err
+	}
+
+	if len(vm.frames) == frameCount {
+		return vm.pop(), nil
+	}
+	return vm.run(frameCount)
+}
+
+// unwindOnError puts the stack back as it was before a run that failed, so
+// the vm can carry on with the next one.
+func (vm *vm) unwindOnError(err *error, stackTop int, frameCount int) {
+	if *err != nil {
+		vm.closeUpvalues(stackTop)
+		vm.stack = vm.stack[:stackTop]
+		vm.frames = vm.frames[:frameCount]
+	}
+}
+
+// arity is how many arguments callee takes, and false if it can't be called.
+func arity(callee Value) (int, bool) {
+	switch callee := callee.object().(type) {
+	case *closure:
+		return callee.function.arity, true
+	case *boundMethod:
+		return callee.method.function.arity, true
+	case *vmClass:
+		if initializer, ok := callee.methods["init"]; ok {
+			return initializer.function.arity, true
+		}
+		return 0, true
+	case *nativeFunction:
+		return callee.arity(), true
+	default:
+		return 0, false
+	}
+}
+
+// run executes instructions until the frame at depth returns.
+func (vm *vm) run(depth int) (Value, error) {
+	frame := vm.frames[len(vm.frames)-1]
+	chunk := frame.closure.function.chunk
+
+	for {
+		if vm.trace != nil {
+			vm.trace.stack(vm.stack)
+			vm.trace.instruction(chunk, frame.ip)
+		}
+
+		op := opCode(chunk.code[frame.ip])
+		frame.ip++
+
+		constants, slots := constantSize, slotSize
+		if op == opWide {
+			op = opCode(chunk.code[frame.ip])
+			frame.ip++
+			constants, slots = wideSize, wideSize
+		}
+
+		switch op {
+		case opConstant:
+			vm.push(chunk.constants[vm.readOperand(frame, constants)])
+		case opNil:
+			vm.push(Nil)
+		case opTrue:
+			vm.push(trueValue)
+		case opFalse:
+			vm.push(falseValue)
+		case opPop:
+			vm.pop()
+		case opGetLocal:
+			vm.push(vm.stack[frame.base+vm.readOperand(frame, slots)])
+		case opSetLocal:
+			vm.stack[frame.base+vm.readOperand(frame, slots)] = vm.peek(0)
+		case opGetGlobal:
+			name := chunk.constants[vm.readOperand(frame, constants)].str()
+			value, ok := vm.globals[name]
+			if !ok {
+				return Nil, vm.undefinedVariable(name, frame.span())
+			}
+			vm.push(value)
+		case opDefineGlobal:
+			name := chunk.constants[vm.readOperand(frame, constants)].str()
+			vm.globals[name] = vm.pop()
+		case opSetGlobal:
+			name := chunk.constants[vm.readOperand(frame, constants)].str()
+			if _, ok := vm.globals[name]; !ok {
+				return Nil, vm.undefinedVariable(name, frame.span())
+			}
+			vm.globals[name] = vm.peek(0)
+		case opGetUpvalue:
+			upvalue := frame.closure.upvalues[vm.readOperand(frame, slots)]
+			if upvalue.open {
+				vm.push(vm.stack[upvalue.slot])
+			} else {
+				vm.push(upvalue.closed)
+			}
+		case opSetUpvalue:
+			upvalue := frame.closure.upvalues[vm.readOperand(frame, slots)]
+			if upvalue.open {
+				vm.stack[upvalue.slot] = vm.peek(0)
+			} else {
+				upvalue.closed = vm.peek(0)
+			}
+		case opGetProperty:
+			name := chunk.constants[vm.readOperand(frame, constants)].str()
+			value, err := vm.getProperty(vm.peek(0), name, frame.span())
+			if err != nil {
+				return Nil, err
+			}
+			vm.stack[len(vm.stack)-1] = value
+		case opSetProperty:
+			name := chunk.constants[vm.readOperand(frame, constants)].str()
+			value := vm.pop()
+			if err := vm.setProperty(vm.pop(), name, value, frame.span()); err != nil {
+				return Nil, err
+			}
+			vm.push(value)
+		case opGetSuper:
+			name := chunk.constants[vm.readOperand(frame, constants)].str()
+			superclass := vm.pop().object().(*vmClass)
+			receiver := vm.pop().object().(*vmInstance)
+			method, ok := superclass.methods[name]
+			if !ok {
+				return Nil, vm.runtimeError(frame.span(), fmt.Errorf("Undefined property '%s'.", name))
+			}
+			bound := &boundMethod{receiver: receiver, method: method}
+			vm.gc.track(bound)
+			vm.push(functionValue(bound))
+		case opEqual:
+			right, left := vm.pop(), vm.pop()
+			vm.push(BoolValue(left.Equal(right)))
+		case opGreater, opGreaterEqual, opLess, opLessEqual, opSubtract, opMultiply, opDivide:
+			if err := vm.checkNumericOperands(frame.span()); err != nil {
+				return Nil, err
+			}
+			right, left := vm.pop().number(), vm.pop().number()
+			switch op {
+			case opGreater:
+				vm.push(BoolValue(left > right))
+			case opGreaterEqual:
+				vm.push(BoolValue(left >= right))
+			case opLess:
+				vm.push(BoolValue(left < right))
+			case opLessEqual:
+				vm.push(BoolValue(left <= right))
+			case opSubtract:
+				vm.push(NumberValue(left - right))
+			case opMultiply:
+				vm.push(NumberValue(left * right))
+			case opDivide:
+				if right == 0 {
+					return Nil, vm.runtimeError(frame.span(), errors.New("cannot divide by zero"))
+				}
+				vm.push(NumberValue(left / right))
+			}
+		case opAdd:
+			right, left := vm.pop(), vm.pop()
+			if left.IsNumber() && right.IsNumber() {
+				vm.push(NumberValue(left.number() + right.number()))
+				continue
+			} else if left.IsString() && right.IsString() {
+				if err := vm.allocate(len(left.str()) + len(right.str())); err != nil {
+					return Nil, vm.runtimeError(frame.span(), err)
+				}
+				vm.push(StringValue(left.str() + right.str()))
+				continue
+			}
+			return Nil, vm.runtimeError(
+				frame.span(),
+				errors.New("Operands must be two numbers or two strings."),
+			)
+		case opNot:
+			vm.push(BoolValue(!vm.pop().Truthy()))
+		case opNegate:
+			if !vm.peek(0).IsNumber() {
+				return Nil, vm.runtimeError(frame.span(), errors.New("Operand must be a number."))
+			}
+			vm.stack[len(vm.stack)-1] = NumberValue(-vm.peek(0).number())
+		case opPrint:
+			fmt.Fprintln(vm.stdout, vm.pop())
+		case opJump:
+			offset := vm.readOperand(frame, jumpSize)
+			frame.ip += offset
+		case opJumpIfFalse:
+			offset := vm.readOperand(frame, jumpSize)
+			if !vm.peek(0).Truthy() {
+				frame.ip += offset
+			}
+		case opLoop:
+			offset := vm.readOperand(frame, jumpSize)
+			if err := vm.checkLimits(); err != nil {
+				return Nil, vm.runtimeError(frame.span(), err)
+			}
+			vm.gc.collectIfNeeded(vm)
+			frame.ip -= offset
+		case opCall:
+			argCount := vm.readOperand(frame, 1)
+			if err := vm.callValue(vm.peek(argCount), argCount, frame.span()); err != nil {
+				return Nil, err
+			}
+			frame = vm.frames[len(vm.frames)-1]
+			chunk = frame.closure.function.chunk
+		case opClosure:
+			function := chunk.constants[vm.readOperand(frame, constants)].object().(*vmFunction)
+			closure := &closure{function: function, upvalues: make([]*upvalue, function.upvalueCount)}
+			for idx := range closure.upvalues {
+				isLocal, index := vm.readOperand(frame, 1), vm.readOperand(frame, slots)
+				if isLocal == 1 {
+					closure.upvalues[idx] = vm.captureUpvalue(frame.base + index)
+				} else {
+					closure.upvalues[idx] = frame.closure.upvalues[index]
+				}
+			}
+			vm.gc.track(closure)
+			vm.push(functionValue(closure))
+		case opCloseUpvalue:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.pop()
+		case opReturn:
+			result := vm.pop()
+			vm.closeUpvalues(frame.base)
+			vm.stack = vm.stack[:frame.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == depth {
+				return result, nil
+			}
+
+			vm.push(result)
+			frame = vm.frames[len(vm.frames)-1]
+			chunk = frame.closure.function.chunk
+		case opClass:
+			name := chunk.constants[vm.readOperand(frame, constants)].str()
+			class := &vmClass{name: name, methods: make(map[string]*closure)}
+			vm.gc.track(class)
+			vm.push(classValue(class))
+		case opInherit:
+			superclass, ok := vm.peek(1).object().(*vmClass)
+			if !ok {
+				return Nil, vm.runtimeError(frame.span(), errors.New("Superclass must be a class."))
+			}
+			subclass := vm.pop().object().(*vmClass)
+			for name, method := range superclass.methods {
+				subclass.methods[name] = method
+			}
+		case opMethod:
+			name := chunk.constants[vm.readOperand(frame, constants)].str()
+			method := vm.pop().object().(*closure)
+			vm.peek(0).object().(*vmClass).methods[name] = method
+		default:
+			return Nil, vm.runtimeError(frame.span(), fmt.Errorf("unknown opcode %d", op))
+		}
+	}
+}
+
+// callValue starts a call to callee, whose arguments are on top of the stack.
+// Closures get a frame for run to carry on in; everything else is called
+// straight away and leaves its result in place of the callee and arguments.
+// span is the whole call expression.
+func (vm *vm) callValue(callee Value, argCount int, span Span) error {
+	paren := closingParen(span)
+
+	switch callee := callee.object().(type) {
+	case *closure:
+		return vm.call(callee, callee.function.name, argCount, span)
+	case *boundMethod:
+		vm.stack[len(vm.stack)-argCount-1] = instanceValue(callee.receiver)
+		return vm.call(callee.method, callee.method.function.name, argCount, span)
+	case *vmClass:
+		if err := vm.allocate(instanceSize); err != nil {
+			return vm.runtimeError(paren, err)
+		}
+		instance := &vmInstance{class: callee, fields: make(map[string]Value)}
+		vm.gc.track(instance)
+		vm.stack[len(vm.stack)-argCount-1] = instanceValue(instance)
+		if initializer, ok := callee.methods["init"]; ok {
+			return vm.call(initializer, callee.name, argCount, span)
+		}
+		if argCount != 0 {
+			return vm.runtimeError(paren, fmt.Errorf("Expected 0 arguments but got %d.", argCount))
+		}
+		return nil
+	case *nativeFunction:
+		return vm.callNative(callee, argCount, span)
+	default:
+		return vm.runtimeError(paren, errors.New("Can only call functions and classes."))
+	}
+}
+
+func (vm *vm) call(closure *closure, name string, argCount int, span Span) error {
+	paren := closingParen(span)
+	if argCount != closure.function.arity {
+		return vm.runtimeError(paren, fmt.Errorf("Expected %d arguments but got %d.", closure.function.arity, argCount))
+	}
+
+	err := vm.checkLimits()
+	if err == nil {
+		err = vm.checkCallDepth(len(vm.frames))
+	}
+	if err == nil {
+		vm.gc.collectIfNeeded(vm)
+	}
+	if err != nil {
+		// The tree-walker has already pushed a frame for the callee when
+		// it checks its limits, so make the trace look the same.
+		rtErr := SpanRuntimeError(paren, err)
+		attachTrace(rtErr, append([]StackFrame{{name, paren.Start}}, vm.stackTrace(span.Start)...))
+		return rtErr
+	}
+
+	vm.frames = append(vm.frames, &frame{closure: closure, base: len(vm.stack) - argCount - 1, name: name})
+	return nil
+}
+
+// callNative calls a Go function. The tree-walker gives natives a stack frame
+// of their own, so errors from them get one in their trace here too.
+func (vm *vm) callNative(native *nativeFunction, argCount int, span Span) error {
+	paren := closingParen(span)
+	if argCount != native.arity() {
+		return vm.runtimeError(paren, fmt.Errorf("Expected %d arguments but got %d.", native.arity(), argCount))
+	}
+
+	err := vm.checkLimits()
+	if err == nil {
+		err = vm.checkCallDepth(len(vm.frames))
+	}
+	if err == nil {
+		err = vm.checkCapabilities(native)
+	}
+	if err == nil {
+		vm.gc.collectIfNeeded(vm)
+	}
+
+	var result Value
+	if err == nil {
+		arguments := make([]Value, argCount)
+		copy(arguments, vm.stack[len(vm.stack)-argCount:])
+		result, err = native.fn(arguments)
+	}
+	if err != nil {
+		rtErr, ok := err.(*runtimeError)
+		if !ok {
+			rtErr = SpanRuntimeError(paren, err)
+		}
+		if rtErr.trace == nil {
+			attachTrace(rtErr, append([]StackFrame{{native.name, rtErr.span.Start}}, vm.stackTrace(span.Start)...))
+		}
+		return rtErr
+	}
+
+	vm.stack = vm.stack[:len(vm.stack)-argCount-1]
+	vm.push(result)
+	return nil
+}
+
+func (vm *vm) getProperty(object Value, name string, span Span) (Value, error) {
+	switch object := object.object().(type) {
+	case *vmInstance:
+		if value, ok := object.fields[name]; ok {
+			return value, nil
+		}
+		if method, ok := object.class.methods[name]; ok {
+			bound := &boundMethod{receiver: object, method: method}
+			vm.gc.track(bound)
+			return functionValue(bound), nil
+		}
+		return Nil, vm.runtimeError(span, fmt.Errorf("Undefined property '%s'.", name))
+	case *hostObject:
+		value, err := object.get(tokenAt(name, span))
+		if err != nil {
+			return Nil, vm.withTrace(err.(*runtimeError))
+		}
+		return value, nil
+	default:
+		return Nil, vm.runtimeError(span, errors.New("Only instances have properties."))
+	}
+}
+
+func (vm *vm) setProperty(object Value, name string, value Value, span Span) error {
+	switch object := object.object().(type) {
+	case *vmInstance:
+		if _, ok := object.fields[name]; !ok {
+			if err := vm.allocate(fieldSize); err != nil {
+				return vm.runtimeError(span, err)
+			}
+		}
+		object.fields[name] = value
+		return nil
+	case *hostObject:
+		if err := object.set(tokenAt(name, span), value); err != nil {
+			return vm.withTrace(err.(*runtimeError))
+		}
+		return nil
+	default:
+		return vm.runtimeError(span, errors.New("Only instances have fields."))
+	}
+}
+
+// captureUpvalue returns the upvalue for a stack slot, sharing it with any
+// other closure that captured the same variable.
+func (vm *vm) captureUpvalue(slot int) *upvalue {
+	for _, upvalue := range vm.openUpvalues {
+		if upvalue.slot == slot {
+			return upvalue
+		}
+	}
+	upvalue := &upvalue{slot: slot, open: true}
+	vm.openUpvalues = append(vm.openUpvalues, upvalue)
+	return upvalue
+}
+
+// closeUpvalues moves variables from last up off the stack and into the
+// upvalues that captured them.
+func (vm *vm) closeUpvalues(last int) {
+	open := vm.openUpvalues[:0]
+	for _, upvalue := range vm.openUpvalues {
+		if upvalue.slot >= last {
+			upvalue.closed = vm.stack[upvalue.slot]
+			upvalue.open = false
+		} else {
+			open = append(open, upvalue)
+		}
+	}
+	vm.openUpvalues = open
+}
+
+func (vm *vm) checkNumericOperands(span Span) error {
+	if !vm.peek(1).IsNumber() || !vm.peek(0).IsNumber() {
+		return vm.runtimeError(span, errors.New("Operands must be numbers."))
+	}
+	return nil
+}
+
+func (vm *vm) undefinedVariable(name string, span Span) error {
+	return vm.withTrace(undefinedVariable(tokenAt(name, span)))
+}
+
+// runtimeError makes an error at span, with a stack trace if it happened
+// inside a function, as the tree-walker does.
+func (vm *vm) runtimeError(span Span, err error) *runtimeError {
+	return vm.withTrace(SpanRuntimeError(span, err))
+}
+
+func (vm *vm) withTrace(err *runtimeError) *runtimeError {
+	if err.trace == nil && len(vm.frames) > 0 && vm.frames[len(vm.frames)-1].closure.function.name != "" {
+		attachTrace(err, vm.stackTrace(err.span.Start))
+	}
+	return err
+}
+
+// stackTrace lists the frames running functions, innermost first, then the
+// script's. Like the tree-walker's, the innermost is positioned at the error
+// and the rest where they made the call that's still running.
+func (vm *vm) stackTrace(at Position) []StackFrame {
+	trace := make([]StackFrame, 0, len(vm.frames))
+	for idx := len(vm.frames) - 1; idx >= 0; idx-- {
+		frame := vm.frames[idx]
+		if frame.closure.function.name == "" {
+			break
+		}
+
+		trace = append(trace, StackFrame{frame.name, at})
+		at = Position{}
+		if idx > 0 {
+			at = vm.frames[idx-1].span().Start
+		}
+	}
+	return append(trace, StackFrame{scriptFrameName, at})
+}
+
+func (vm *vm) push(value Value) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *vm) pop() Value {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *vm) peek(distance int) Value {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+func (vm *vm) readOperand(frame *frame, size int) int {
+	operand := frame.closure.function.chunk.readOperand(frame.ip, size)
+	frame.ip += size
+	return operand
+}
+
+// closingParen is the span of the ')' ending the call expression span.
+func closingParen(call Span) Span {
+	start := call.End
+	if start.Column > 0 {
+		start.Offset--
+		start.Column--
+	}
+	return Span{start, call.End}
+}
+
+// tokenAt makes an identifier token for name at span, for errors that expect
+// one.
+func tokenAt(name string, span Span) *Token {
+	return NewTokenAt(IDENTIFIER, name, nil, span.Start.Line, span.Start.Offset, span.Start.Column)
+}
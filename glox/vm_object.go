@@ -0,0 +1,71 @@
+package glox
+
+import "fmt"
+
+// vmFunction is a function compiled to bytecode. The top level of a script
+// is compiled to one too, with no name.
+type vmFunction struct {
+	name         string
+	arity        int
+	upvalueCount int
+	chunk        *Chunk
+}
+
+func (f *vmFunction) String() string {
+	if f.name == "" {
+		return scriptFrameName
+	}
+	return fmt.Sprintf("<fn %s>", f.name)
+}
+
+// upvalue is a variable captured by a closure. While the variable's still on
+// the stack the upvalue refers to its slot; once the variable goes out of
+// scope its value moves into the upvalue itself.
+type upvalue struct {
+	gcHeader
+	slot   int
+	open   bool
+	closed Value
+}
+
+type closure struct {
+	gcHeader
+	function *vmFunction
+	upvalues []*upvalue
+}
+
+func (c *closure) String() string {
+	return c.function.String()
+}
+
+// vmClass has its superclass's methods copied into it when it inherits, so
+// there's no chain to walk at runtime.
+type vmClass struct {
+	gcHeader
+	name    string
+	methods map[string]*closure
+}
+
+func (c *vmClass) String() string {
+	return c.name
+}
+
+type vmInstance struct {
+	gcHeader
+	class  *vmClass
+	fields map[string]Value
+}
+
+func (i *vmInstance) String() string {
+	return i.class.name + " instance"
+}
+
+type boundMethod struct {
+	gcHeader
+	receiver *vmInstance
+	method   *closure
+}
+
+func (b *boundMethod) String() string {
+	return b.method.String()
+}
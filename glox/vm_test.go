@@ -0,0 +1,150 @@
+package glox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// runBoth runs source on both engines, returning each one's output and error
+// diagnostics.
+func runBoth(source string) (tree string, vm string) {
+	run := func(engine Engine) string {
+		var out bytes.Buffer
+		runtime := New(WithEngine(engine), WithStdout(&out), WithStderr(&out), WithFileName("test.lox"))
+		runtime.Run(source, 0)
+		return out.String()
+	}
+	return run(EngineTree), run(EngineVM)
+}
+
+func TestVMMatchesInterpreter(t *testing.T) {
+	testcases := []string{
+		`print 1 + 2 * 3 - 4 / 2; print -(1); print !true; print 1 != 2;`,
+		`print "con" + "cat"; print nil; print 0.5 >= 1; print nil == false;`,
+		`var a = 1; { var a = 2; print a; } print a; a = 3; print a;`,
+		`print nil or "or"; print false and 1; print 1 ? "yes" : "no";`,
+		`var i = 0; while (i < 3) { print i; i = i + 1; }`,
+		`for (var i = 0; i < 3; i = i + 1) { fun f() { print i; } f(); }`,
+		`if (false) print "then"; else print "else";`,
+		`fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); } print fib(15); print fib;`,
+		`fun counter() { var n = 0; fun inc() { n = n + 1; return n; } return inc; }
+		 var c = counter(); c(); print c();`,
+		`var f; { var x = "before"; fun get() { return x; } f = get; x = "after"; } print f();`,
+		`fun outer() { var a = "a"; fun mid() { fun inner() { return a; } return inner; } return mid; }
+		 print outer()()();`,
+		`class A { init(x) { this.x = x; } say() { print "A " + this.x; } }
+		 class B < A { init() { super.init("b"); } say() { super.say(); print "B"; } }
+		 var b = B(); b.say(); print b; print B; print b.say; print b.init();`,
+		`class C { m() { return this; } } var m = C().m; print m();`,
+		`class D {} var d = D(); d.field = "set"; print d.field;`,
+		`fun noReturn() {} print noReturn(); print clock;`,
+		`print 1 + nil;`,
+		`print -"x";`,
+		`print 1 / 0;`,
+		`print missing;`,
+		`missing = 1;`,
+		`"str"();`,
+		`fun two(a, b) {} two(1);`,
+		`class E {} E(1);`,
+		`class F {} print F().missing;`,
+		`var n = 1; n.field = 1;`,
+		`var NotClass = 1; class G < NotClass {}`,
+		`class H {} class I < H { m() { return super.missing; } } I().m();`,
+		`fun f() { g(); } fun g() { return 1 < "x"; } f();`,
+		`fun r() { return r(); } r();`,
+		`print "before"; print 1 + nil; print "after";`,
+	}
+
+	for _, source := range testcases {
+		tree, vm := runBoth(source)
+		if tree != vm {
+			t.Errorf("%s\nTree:\n%s\nVM:\n%s", source, tree, vm)
+		}
+	}
+}
+
+func TestVMEval(t *testing.T) {
+	runtime := New(WithEngine(EngineVM))
+	if _, err := runtime.Eval(context.Background(), "fun add(a, b) { return a + b; }"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	value, err := runtime.Eval(context.Background(), "add(1, 2);")
+	if err != nil || value != NumberValue(3) {
+		t.Errorf("Expected: 3 Actual: %v, %v", value, err)
+	}
+
+	value, err = runtime.Call("add", StringValue("a"), StringValue("b"))
+	if err != nil || value != StringValue("ab") {
+		t.Errorf("Expected: ab Actual: %v, %v", value, err)
+	}
+	if _, err := runtime.Call("add", NumberValue(1)); err == nil {
+		t.Errorf("Expected an arity error")
+	}
+}
+
+func TestVMCarriesOnAfterError(t *testing.T) {
+	runtime := New(WithEngine(EngineVM), WithStderr(io.Discard))
+	runtime.Run("fun f() { var a = 1; return a + nil; } f();", 0)
+
+	value, err := runtime.Eval(context.Background(), "var b = 2; b;")
+	if err != nil || value != NumberValue(2) {
+		t.Errorf("Expected: 2 Actual: %v, %v", value, err)
+	}
+	if len(runtime.vm.stack) != 0 || len(runtime.vm.frames) != 0 {
+		t.Errorf("Expected an empty stack, got %v and %d frames", runtime.vm.stack, len(runtime.vm.frames))
+	}
+}
+
+func TestVMNatives(t *testing.T) {
+	runtime := New(WithEngine(EngineVM))
+	runtime.DefineNative("double", 1, func(args []Value) (Value, error) {
+		n, err := args[0].AsNumber()
+		return NumberValue(n * 2), err
+	})
+
+	value, err := runtime.Eval(context.Background(), "double(21);")
+	if err != nil || value != NumberValue(42) {
+		t.Errorf("Expected: 42 Actual: %v, %v", value, err)
+	}
+
+	_, err = runtime.Eval(context.Background(), "clock();")
+	if !errors.Is(err, ErrNotPermitted) {
+		t.Errorf("Expected %v, got %v", ErrNotPermitted, err)
+	}
+}
+
+func TestVMStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := New(WithEngine(EngineVM)).Eval(ctx, "while (true) {}")
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Expected %v, got %v", ErrInterrupted, err)
+	}
+}
+
+func TestVMClone(t *testing.T) {
+	runtime := preloadedRuntime(t, WithEngine(EngineVM))
+	clone := runtime.Clone()
+
+	evalString(t, clone, "counter(); node.rename(\"second\");")
+	if actual := evalString(t, runtime, "counter();"); actual != "1" {
+		t.Errorf("Expected the original counter to be untouched, got %s", actual)
+	}
+	if actual := evalString(t, clone, "alias.name + node.next.name;"); actual != "secondsecond" {
+		t.Errorf("Expected shared references to stay shared, got %s", actual)
+	}
+}
+
+func TestParseEngine(t *testing.T) {
+	if engine, err := ParseEngine("vm"); err != nil || engine != EngineVM {
+		t.Errorf("Expected: EngineVM Actual: %v, %v", engine, err)
+	}
+	if _, err := ParseEngine("jit"); err == nil {
+		t.Errorf("Expected an error for an unknown engine")
+	}
+}
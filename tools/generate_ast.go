@@ -20,6 +20,25 @@ func main() {
 		"Literal : value interface{}",
 		"Unary : operator *Token, right Expr",
 		"Ternary : left Expr, leftOperator *Token, middle Expr, rightOperator *Token, right Expr",
+		"Variable : resolution, name *Token",
+		"Assign : resolution, name *Token, value Expr",
+		"Logical : left Expr, operator *Token, right Expr",
+		"Call : callee Expr, paren *Token, arguments []Expr",
+		"Get : object Expr, name *Token",
+		"Set : object Expr, name *Token, value Expr",
+		"This : resolution, keyword *Token",
+		"Super : resolution, keyword *Token, method *Token",
+	})
+	defineAst(outputDir, "Stmt", []string{
+		"Expression : expression Expr",
+		"Print : expression Expr",
+		"Var : name *Token, initializer Expr",
+		"Block : statements []Stmt",
+		"If : condition Expr, thenBranch Stmt, elseBranch Stmt",
+		"While : condition Expr, body Stmt",
+		"Function : name *Token, params []*Token, body []Stmt",
+		"Return : keyword *Token, value Expr",
+		"Class : name *Token, superclass *Variable, methods []*Function",
 	})
 }
 
@@ -37,6 +56,7 @@ func defineAst(outputDir string, baseName string, types []string) error {
 
 	// go will format automagically when the file is open so forget about indentation
 	writer.WriteString("type " + baseName + " interface {")
+	writer.WriteString("Node\n")
 	writer.WriteString("Accept(Visitor" + baseName + ") (interface{}, error)\n")
 	writer.WriteString("}\n\n")
 
@@ -52,9 +72,20 @@ func defineAst(outputDir string, baseName string, types []string) error {
 	return nil
 }
 
+// defineType writes one node type. A field without a type, like
+// "resolution", is embedded and left out of the constructor.
 func defineType(writer *bufio.Writer, baseName, structName, fields string) {
 	writer.WriteString("type " + structName + " struct {\n")
-	fieldList := strings.Split(fields, ", ")
+	writer.WriteString("node\n")
+	fieldList := make([]string, 0)
+	for _, field := range strings.Split(fields, ", ") {
+		if !strings.Contains(field, " ") {
+			writer.WriteString(field + "\n")
+		} else {
+			fieldList = append(fieldList, field)
+		}
+	}
+	fields = strings.Join(fieldList, ", ")
 	for _, field := range fieldList {
 		vs := strings.Split(field, " ")
 		for i, v := range vs {
@@ -72,7 +103,7 @@ func defineType(writer *bufio.Writer, baseName, structName, fields string) {
 	args := make([]string, 0)
 	for _, field := range fieldList {
 		name := strings.Split(field, " ")[0]
-		args = append(args, name)
+		args = append(args, strings.Title(name)+": "+name)
 	}
 	writer.WriteString(strings.Join(args, ","))
 